@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"koth.cyber.cs.unh.edu/lib"
@@ -33,22 +34,25 @@ func open() (*sql.DB, error) {
 	return db, err
 }
 
-func Connect() error {
+// Open opens the database without touching its schema.
+func Open() error {
 	var err error
 
 	db, err = open()
+	return err
+}
 
-	if err != nil {
+// Connect opens the database and brings its schema up to date.
+func Connect() error {
+	if err := Open(); err != nil {
 		return err
 	}
 
-	if _, err = db.Exec(TEAMS_STATEMENT); err != nil {
-		return err
-	}
+	applied, err := Migrate()
 
-	if _, err = db.Exec(BLOBS_STATEMENT); err != nil {
-		return err
+	for _, migration := range applied {
+		lib.Log.Status(fmt.Sprintf("Applied database migration %d (%s)", migration.Version, migration.Name))
 	}
 
-	return nil
+	return err
 }
@@ -8,11 +8,6 @@ import (
 var ErrBlobExists = errors.New("blob already exists")
 var ErrBlobNotFound = errors.New("blob not found")
 
-const BLOBS_STATEMENT = `CREATE TABLE IF NOT EXISTS blobs (
-	name TEXT PRIMARY KEY NOT NULL,
-	value TEXT NOT NULL
-);`
-
 const INSERT_BLOB_STATEMENT = `INSERT INTO blobs (name, value) VALUES (?, ?);`
 const SELECT_BLOB_STATEMENT = `SELECT name, value FROM blobs WHERE name = ?;`
 const DELETE_BLOB_STATEMENT = `DELETE FROM blobs WHERE name = ?;`
@@ -102,3 +97,13 @@ func GetAllBlobs() ([]*DBBlob, error) {
 func UpdateBlob(blob *DBBlob) error {
 	return QueuedExec(UPDATE_BLOB_STATEMENT, blob.Value, blob.Name)
 }
+
+// SetBlob creates the blob or replaces its value.
+func SetBlob(name, value string) error {
+	if BlobExists(name) {
+		return UpdateBlob(&DBBlob{Name: name, Value: value})
+	}
+
+	_, err := CreateBlob(name, value)
+	return err
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrBoxRevertInProgress = errors.New("a revert is already in progress")
+var ErrBoxRevertCooldown = errors.New("revert is cooling down")
+var ErrBoxRevertNotFound = errors.New("revert not found")
+
+const (
+	BoxRevertPending = "pending"
+	BoxRevertDone    = "done"
+	BoxRevertFailed  = "failed"
+)
+
+const INSERT_BOX_REVERT_STATEMENT = `INSERT INTO box_reverts (team, requested_by, requested_at, status, cost, ledger_id) VALUES (?, ?, ?, ?, ?, ?);`
+const SELECT_BOX_REVERT_STATEMENT = `SELECT id, team, requested_by, requested_at, finished_at, status, error, cost, ledger_id FROM box_reverts WHERE id = ?;`
+const SELECT_BOX_REVERTS_STATEMENT = `SELECT id, team, requested_by, requested_at, finished_at, status, error, cost, ledger_id FROM box_reverts WHERE (? = '' OR team = ?) ORDER BY id DESC LIMIT ?;`
+
+// Failed reverts are refunded, so they do not count toward the cooldown
+const SELECT_LAST_BOX_REVERT_STATEMENT = `SELECT id, team, requested_by, requested_at, finished_at, status, error, cost, ledger_id FROM box_reverts WHERE team = ? AND status != 'failed' ORDER BY id DESC LIMIT 1;`
+const SELECT_PENDING_BOX_REVERT_IDS_STATEMENT = `SELECT id FROM box_reverts WHERE status = 'pending';`
+const UPDATE_BOX_REVERT_FINISHED_STATEMENT = `UPDATE box_reverts SET status = ?, error = ?, finished_at = ? WHERE id = ? AND status = 'pending';`
+
+// DBBoxRevert is a team's box being rolled back to its post-provisioning
+// snapshot. LedgerID is the entry that charged Cost for it.
+type DBBoxRevert struct {
+	ID          int64     `json:"id"`
+	Team        string    `json:"team"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error"`
+	Cost        int       `json:"cost"`
+	LedgerID    int64     `json:"ledger_id"`
+}
+
+func (b *DBBoxRevert) JSON() []byte {
+	json, _ := json.Marshal(b)
+	return json
+}
+
+func scanBoxRevert(scanner interface{ Scan(...any) error }) (*DBBoxRevert, error) {
+	var revert DBBoxRevert
+	var requestedAt, finishedAt int64
+
+	if err := scanner.Scan(&revert.ID, &revert.Team, &revert.RequestedBy, &requestedAt, &finishedAt, &revert.Status, &revert.Error, &revert.Cost, &revert.LedgerID); err != nil {
+		return nil, err
+	}
+
+	revert.RequestedAt = time.Unix(requestedAt, 0)
+
+	if finishedAt != 0 {
+		revert.FinishedAt = time.Unix(finishedAt, 0)
+	}
+
+	return &revert, nil
+}
+
+// RequestBoxRevert records a pending revert of team's box and charges cost
+// for it, unless one is still running or the last one was less than cooldown
+// ago.
+func RequestBoxRevert(team, actor string, cost int, cooldown time.Duration, now time.Time) (*DBBoxRevert, error) {
+	var revert *DBBoxRevert
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		last, err := scanBoxRevert(tx.QueryRow(SELECT_LAST_BOX_REVERT_STATEMENT, team))
+
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if err == nil {
+			if last.Status == BoxRevertPending {
+				return ErrBoxRevertInProgress
+			}
+
+			if next := last.RequestedAt.Add(cooldown); now.Before(next) {
+				return fmt.Errorf("%w, the next revert is allowed at %s", ErrBoxRevertCooldown, next.Format(time.RFC3339))
+			}
+		}
+
+		revert = &DBBoxRevert{
+			Team:        team,
+			RequestedBy: actor,
+			RequestedAt: now,
+			Status:      BoxRevertPending,
+			Cost:        cost,
+		}
+
+		if cost != 0 {
+			var charge *DBLedgerEntry = &DBLedgerEntry{
+				Team:      team,
+				Source:    LedgerSourceBoxRevert,
+				Amount:    -cost,
+				Reason:    "Box reverted to its provisioned snapshot",
+				Actor:     actor,
+				CreatedAt: now,
+			}
+
+			if err := insertLedgerEntries(tx, []*DBLedgerEntry{charge}); err != nil {
+				return err
+			}
+
+			revert.LedgerID = charge.ID
+		}
+
+		result, err := tx.Exec(INSERT_BOX_REVERT_STATEMENT, revert.Team, revert.RequestedBy, revert.RequestedAt.Unix(), revert.Status, revert.Cost, revert.LedgerID)
+
+		if err != nil {
+			return err
+		}
+
+		revert.ID, err = result.LastInsertId()
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return revert, nil
+}
+
+// FinishBoxRevert records how revert id ended. A failed revert is refunded by
+// reverting its charge; a successful one raises an event.
+func FinishBoxRevert(id int64, failure error, now time.Time) (*DBBoxRevert, error) {
+	var revert *DBBoxRevert
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		var err error
+		revert, err = scanBoxRevert(tx.QueryRow(SELECT_BOX_REVERT_STATEMENT, id))
+
+		if err == sql.ErrNoRows {
+			return ErrBoxRevertNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if revert.Status != BoxRevertPending {
+			return nil
+		}
+
+		revert.Status = BoxRevertDone
+		revert.FinishedAt = now
+
+		if failure != nil {
+			revert.Status = BoxRevertFailed
+			revert.Error = failure.Error()
+		}
+
+		if _, err := tx.Exec(UPDATE_BOX_REVERT_FINISHED_STATEMENT, revert.Status, revert.Error, now.Unix(), revert.ID); err != nil {
+			return err
+		}
+
+		if failure == nil {
+			return insertEvents(tx, []*DBEvent{{
+				CreatedAt: now,
+				Kind:      EventKindBoxRevert,
+				Team:      revert.Team,
+				Points:    -revert.Cost,
+				Message:   fmt.Sprintf("%s reverted to its provisioned snapshot, requested by %s", revert.Team, revert.RequestedBy),
+			}})
+		}
+
+		if revert.LedgerID == 0 {
+			return nil
+		}
+
+		// An admin may have already reverted the charge by hand
+		if charge, err := scanLedgerEntry(tx.QueryRow(SELECT_LEDGER_ENTRY_STATEMENT, revert.LedgerID)); err != nil || charge.RevertedBy != 0 {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+
+			return err
+		}
+
+		return insertLedgerEntries(tx, []*DBLedgerEntry{{
+			Team:      revert.Team,
+			Source:    LedgerSourceRevert,
+			Amount:    revert.Cost,
+			Reason:    "Box revert failed: " + revert.Error,
+			Actor:     LedgerActorSystem,
+			CreatedAt: now,
+			Reverts:   revert.LedgerID,
+		}})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return revert, nil
+}
+
+// GetPendingBoxRevertIDs returns the IDs of reverts that have not finished.
+func GetPendingBoxRevertIDs() ([]int64, error) {
+	rows, err := QueuedQuery(SELECT_PENDING_BOX_REVERT_IDS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// GetBoxReverts returns up to limit reverts, newest first. An empty team
+// matches all.
+func GetBoxReverts(team string, limit int) ([]*DBBoxRevert, error) {
+	rows, err := QueuedQuery(SELECT_BOX_REVERTS_STATEMENT, team, team, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var reverts []*DBBoxRevert
+	for rows.Next() {
+		revert, err := scanBoxRevert(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reverts = append(reverts, revert)
+	}
+
+	return reverts, nil
+}
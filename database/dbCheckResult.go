@@ -0,0 +1,297 @@
+package database
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	CheckStatusUp      = "up"
+	CheckStatusDown    = "down"
+	CheckStatusTimeout = "timeout"
+	CheckStatusPartial = "partial"
+	CheckStatusSkipped = "skipped"
+)
+
+// CheckStatusIsUp reports whether status counts towards uptime. A partial
+// result means the service is degraded, not down.
+func CheckStatusIsUp(status string) bool {
+	return status == CheckStatusUp || status == CheckStatusPartial
+}
+
+const INSERT_CHECK_RESULT_STATEMENT = `INSERT INTO check_results (round_id, team, check_name, status, points, latency_ms, reason, evidence, multiplier, multipliers, credit) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+const SELECT_CHECK_RESULTS_STATEMENT = `SELECT round_id, team, check_name, status, points, latency_ms, reason, evidence, multiplier, multipliers, credit FROM check_results WHERE round_id >= ? AND round_id <= ? AND (? = '' OR team = ?) ORDER BY round_id, team, check_name;`
+
+const UPDATE_CHECK_RESULT_POINTS_STATEMENT = `UPDATE check_results SET points = ? WHERE round_id = ? AND team = ? AND check_name = ?;`
+
+// Skipped results say nothing about the service, so they are left out of its
+// stats. Void rounds were our own outage, so their results are left out too,
+// as are the results of the round still being written.
+const SELECT_CHECK_STATS_STATEMENT = `SELECT c.team, c.check_name, COUNT(*), SUM(c.status IN ('up', 'partial')), (
+	SELECT COUNT(*) FROM check_results s WHERE s.team = c.team AND s.check_name = c.check_name AND s.status != 'skipped' AND s.round_id IN (SELECT id FROM rounds WHERE finished_at != 0 AND voided_at = 0) AND s.round_id > COALESCE((
+		SELECT MAX(u.round_id) FROM check_results u WHERE u.team = c.team AND u.check_name = c.check_name AND u.status IN ('up', 'partial') AND u.round_id IN (SELECT id FROM rounds WHERE finished_at != 0 AND voided_at = 0)
+	), 0)
+) FROM check_results c WHERE c.status != 'skipped' AND c.round_id IN (SELECT id FROM rounds WHERE finished_at != 0 AND voided_at = 0) GROUP BY c.team, c.check_name;`
+
+type DBCheckResult struct {
+	RoundID   int64  `json:"round_id"`
+	Team      string `json:"team"`
+	Check     string `json:"check"`
+	Status    string `json:"status"`
+	Points    int    `json:"points"`
+	LatencyMS int64  `json:"latency_ms"`
+	Reason    string `json:"reason"`
+	Evidence  string `json:"evidence"`
+
+	// Multiplier scaled Points, Multipliers names the rules behind it
+	Multiplier  float64 `json:"multiplier"`
+	Multipliers string  `json:"multipliers"`
+
+	// Credit is the share of the reward a partial result earned, it is nil
+	// for other results and for partial results stored before it was kept
+	Credit *float64 `json:"credit,omitempty"`
+}
+
+func (r *DBCheckResult) JSON() []byte {
+	json, _ := json.Marshal(r)
+	return json
+}
+
+func CreateCheckResults(results []*DBCheckResult) error {
+	return QueuedTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(INSERT_CHECK_RESULT_STATEMENT)
+		if err != nil {
+			return err
+		}
+
+		defer stmt.Close()
+
+		for _, result := range results {
+			if _, err := stmt.Exec(result.RoundID, result.Team, result.Check, result.Status, result.Points, result.LatencyMS, result.Reason, result.Evidence, result.Multiplier, result.Multipliers, result.Credit); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetCheckResults returns every result recorded for rounds in [firstRound,
+// lastRound]. An empty team matches all teams.
+func GetCheckResults(firstRound, lastRound int64, team string) ([]*DBCheckResult, error) {
+	rows, err := QueuedQuery(SELECT_CHECK_RESULTS_STATEMENT, firstRound, lastRound, team, team)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var results []*DBCheckResult
+	for rows.Next() {
+		var result DBCheckResult
+		if err := rows.Scan(&result.RoundID, &result.Team, &result.Check, &result.Status, &result.Points, &result.LatencyMS, &result.Reason, &result.Evidence, &result.Multiplier, &result.Multipliers, &result.Credit); err != nil {
+			return nil, err
+		}
+
+		results = append(results, &result)
+	}
+
+	return results, nil
+}
+
+// DBCheckStats aggregates every recorded result for one team and check.
+// FailureStreak counts the results since the check was last up.
+type DBCheckStats struct {
+	Team          string `json:"team"`
+	Check         string `json:"check"`
+	Total         int    `json:"total"`
+	Up            int    `json:"up"`
+	FailureStreak int    `json:"failure_streak"`
+}
+
+func GetCheckStats() ([]*DBCheckStats, error) {
+	rows, err := QueuedQuery(SELECT_CHECK_STATS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var stats []*DBCheckStats
+	for rows.Next() {
+		var stat DBCheckStats
+		if err := rows.Scan(&stat.Team, &stat.Check, &stat.Total, &stat.Up, &stat.FailureStreak); err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, &stat)
+	}
+
+	return stats, nil
+}
+
+// DBRescoreChange sums up how rescoring changed one check's results for one
+// team.
+type DBRescoreChange struct {
+	Team    string `json:"team"`
+	Check   string `json:"check"`
+	Results int    `json:"results"`
+	Before  int    `json:"before"`
+	After   int    `json:"after"`
+}
+
+// errRescorePreview rolls back a rescore that was only previewed
+var errRescorePreview = errors.New("rescore preview")
+
+// RescoreCheckResults recomputes the points of every stored check result
+// outside of void rounds with points, which returns false to keep a result as
+// it is. With apply set, the new points are stored and every team gets one
+// rescore ledger entry per round for its difference, all in a single
+// transaction; otherwise nothing is written. Tying the entries to their round
+// lets voiding the round later revert them too.
+func RescoreCheckResults(points func(*DBCheckResult) (int, bool), apply bool, actor, reason string) ([]*DBRescoreChange, []*DBLedgerEntry, error) {
+	var changes []*DBRescoreChange
+	var entries []*DBLedgerEntry
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		changes, entries = nil, nil
+
+		var void map[int64]bool = make(map[int64]bool)
+		voidRows, err := tx.Query(SELECT_VOID_ROUND_IDS_STATEMENT)
+
+		if err != nil {
+			return err
+		}
+
+		for voidRows.Next() {
+			var id int64
+
+			if err := voidRows.Scan(&id); err != nil {
+				voidRows.Close()
+				return err
+			}
+
+			void[id] = true
+		}
+
+		voidRows.Close()
+
+		rows, err := tx.Query(SELECT_CHECK_RESULTS_STATEMENT, 0, int64(math.MaxInt64), "", "")
+
+		if err != nil {
+			return err
+		}
+
+		var rescored []*DBCheckResult
+		var byCheck map[[2]string]*DBRescoreChange = make(map[[2]string]*DBRescoreChange)
+		var byRound map[string]map[int64]*DBLedgerEntry = make(map[string]map[int64]*DBLedgerEntry)
+
+		for rows.Next() {
+			var result DBCheckResult
+			if err := rows.Scan(&result.RoundID, &result.Team, &result.Check, &result.Status, &result.Points, &result.LatencyMS, &result.Reason, &result.Evidence, &result.Multiplier, &result.Multipliers, &result.Credit); err != nil {
+				rows.Close()
+				return err
+			}
+
+			if void[result.RoundID] {
+				continue
+			}
+
+			after, ok := points(&result)
+
+			if !ok || after == result.Points {
+				continue
+			}
+
+			key := [2]string{result.Team, result.Check}
+
+			if byCheck[key] == nil {
+				byCheck[key] = &DBRescoreChange{Team: result.Team, Check: result.Check}
+				changes = append(changes, byCheck[key])
+			}
+
+			byCheck[key].Results++
+			byCheck[key].Before += result.Points
+			byCheck[key].After += after
+
+			if byRound[result.Team] == nil {
+				byRound[result.Team] = make(map[int64]*DBLedgerEntry)
+			}
+
+			if byRound[result.Team][result.RoundID] == nil {
+				byRound[result.Team][result.RoundID] = &DBLedgerEntry{
+					Team:    result.Team,
+					Source:  LedgerSourceRescore,
+					Reason:  reason,
+					Actor:   actor,
+					RoundID: result.RoundID,
+				}
+				entries = append(entries, byRound[result.Team][result.RoundID])
+			}
+
+			byRound[result.Team][result.RoundID].Amount += after - result.Points
+
+			result.Points = after
+			rescored = append(rescored, &result)
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		slices.SortFunc(changes, func(a, b *DBRescoreChange) int {
+			if c := strings.Compare(a.Team, b.Team); c != 0 {
+				return c
+			}
+
+			return strings.Compare(a.Check, b.Check)
+		})
+
+		slices.SortFunc(entries, func(a, b *DBLedgerEntry) int {
+			if c := strings.Compare(a.Team, b.Team); c != 0 {
+				return c
+			}
+
+			return cmp.Compare(a.RoundID, b.RoundID)
+		})
+
+		entries = slices.DeleteFunc(entries, func(entry *DBLedgerEntry) bool {
+			return entry.Amount == 0
+		})
+
+		if !apply {
+			return errRescorePreview
+		}
+
+		stmt, err := tx.Prepare(UPDATE_CHECK_RESULT_POINTS_STATEMENT)
+
+		if err != nil {
+			return err
+		}
+
+		defer stmt.Close()
+
+		for _, result := range rescored {
+			if _, err := stmt.Exec(result.Points, result.RoundID, result.Team, result.Check); err != nil {
+				return err
+			}
+		}
+
+		return insertLedgerEntries(tx, entries)
+	})
+
+	if err != nil && !errors.Is(err, errRescorePreview) {
+		return nil, nil, err
+	}
+
+	return changes, entries, nil
+}
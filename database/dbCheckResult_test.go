@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVoidRoundRevertsItsRescore(t *testing.T) {
+	openTestDatabase(t)
+
+	var start time.Time = time.Unix(1700000000, 0)
+	first := finishedRound(t, start)
+	second := finishedRound(t, start.Add(time.Minute))
+
+	if err := CreateCheckResults([]*DBCheckResult{
+		{RoundID: first.ID, Team: "alpha", Check: "web", Status: CheckStatusUp, Points: 1, Multiplier: 1},
+		{RoundID: second.ID, Team: "alpha", Check: "web", Status: CheckStatusUp, Points: 1, Multiplier: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CreateLedgerEntries([]*DBLedgerEntry{
+		{Team: "alpha", Source: LedgerSourceCheck, Amount: 1, RoundID: first.ID},
+		{Team: "alpha", Source: LedgerSourceCheck, Amount: 1, RoundID: second.ID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, entries, err := RescoreCheckResults(func(*DBCheckResult) (int, bool) {
+		return 3, true
+	}, true, "admin", "web reward was too low")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected a rescore entry for each round, got %d", len(entries))
+	}
+
+	if _, err := VoidRound(second.ID, "admin", "scorer lost its route"); err != nil {
+		t.Fatal(err)
+	}
+
+	totals, err := GetLedgerTotals()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if totals["alpha"] != 3 {
+		t.Fatalf("expected only the rescored first round to count, got %d", totals["alpha"])
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventKindSLAViolation   = "sla_violation"
+	EventKindRoundVoid      = "round_void"
+	EventKindFlagCaptured   = "flag_captured"
+	EventKindInjectReleased = "inject_released"
+	EventKindBoxRevert      = "box_revert"
+)
+
+const INSERT_EVENT_STATEMENT = `INSERT INTO events (round_id, created_at, kind, team, subject, points, message) VALUES (?, ?, ?, ?, ?, ?, ?);`
+const SELECT_EVENTS_STATEMENT = `SELECT id, round_id, created_at, kind, team, subject, points, message FROM events WHERE id > ? AND (? = 0 OR id <= ?) AND (? = '' OR team = ?) AND (? = '' OR kind = ?) ORDER BY id DESC LIMIT ?;`
+const SELECT_ROUND_EVENTS_STATEMENT = `SELECT id, round_id, created_at, kind, team, subject, points, message FROM events WHERE round_id >= ? AND round_id <= ? AND (? = '' OR team = ?) ORDER BY id;`
+const SELECT_EVENT_COUNTS_STATEMENT = `SELECT team, subject, COUNT(*) FROM events WHERE kind = ? GROUP BY team, subject;`
+
+// DBEvent is something notable that happened to a team, e.g. an SLA
+// violation. Subject names what the event is about, such as a check.
+type DBEvent struct {
+	ID        int64     `json:"id"`
+	RoundID   int64     `json:"round_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Kind      string    `json:"kind"`
+	Team      string    `json:"team"`
+	Subject   string    `json:"subject"`
+	Points    int       `json:"points"`
+	Message   string    `json:"message"`
+}
+
+func (e *DBEvent) JSON() []byte {
+	json, _ := json.Marshal(e)
+	return json
+}
+
+func insertEvents(tx *sql.Tx, events []*DBEvent) error {
+	stmt, err := tx.Prepare(INSERT_EVENT_STATEMENT)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, event := range events {
+		result, err := stmt.Exec(event.RoundID, event.CreatedAt.Unix(), event.Kind, event.Team, event.Subject, event.Points, event.Message)
+
+		if err != nil {
+			return err
+		}
+
+		if event.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func CreateEvents(events []*DBEvent) error {
+	return QueuedTransaction(func(tx *sql.Tx) error {
+		return insertEvents(tx, events)
+	})
+}
+
+func scanEvents(rows *sql.Rows) ([]*DBEvent, error) {
+	var events []*DBEvent
+	for rows.Next() {
+		var event DBEvent
+		var createdAt int64
+
+		if err := rows.Scan(&event.ID, &event.RoundID, &createdAt, &event.Kind, &event.Team, &event.Subject, &event.Points, &event.Message); err != nil {
+			return nil, err
+		}
+
+		event.CreatedAt = time.Unix(createdAt, 0)
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// GetEvents returns up to limit events in (afterID, untilID], newest first.
+// A zero untilID, empty team or empty kind matches all.
+func GetEvents(afterID, untilID int64, team, kind string, limit int) ([]*DBEvent, error) {
+	rows, err := QueuedQuery(SELECT_EVENTS_STATEMENT, afterID, untilID, untilID, team, team, kind, kind, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return scanEvents(rows)
+}
+
+// GetRoundEvents returns the events raised by rounds in [firstRound,
+// lastRound], oldest first. An empty team matches all teams.
+func GetRoundEvents(firstRound, lastRound int64, team string) ([]*DBEvent, error) {
+	rows, err := QueuedQuery(SELECT_ROUND_EVENTS_STATEMENT, firstRound, lastRound, team, team)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return scanEvents(rows)
+}
+
+type DBEventCount struct {
+	Team    string `json:"team"`
+	Subject string `json:"subject"`
+	Count   int    `json:"count"`
+}
+
+// GetEventCounts counts the events of kind per team and subject.
+func GetEventCounts(kind string) ([]*DBEventCount, error) {
+	rows, err := QueuedQuery(SELECT_EVENT_COUNTS_STATEMENT, kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var counts []*DBEventCount
+	for rows.Next() {
+		var count DBEventCount
+		if err := rows.Scan(&count.Team, &count.Subject, &count.Count); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, &count)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrFlagNotFound = errors.New("flag not found")
+var ErrFlagCaptured = errors.New("flag already captured")
+
+const INSERT_FLAG_STATEMENT = `INSERT INTO flags (team, name, path, value, created_at) VALUES (?, ?, ?, ?, ?);`
+
+// Flags that were never captured are replaced when a team's box is planted
+// again; captured ones are kept for the record.
+const DELETE_UNCAPTURED_FLAGS_STATEMENT = `DELETE FROM flags WHERE team = ? AND captured_at = 0;`
+const SELECT_FLAG_BY_VALUE_STATEMENT = `SELECT id, team, name, path, value, created_at, captured_at, captured_by, points FROM flags WHERE value = ?;`
+const SELECT_FLAGS_STATEMENT = `SELECT id, team, name, path, value, created_at, captured_at, captured_by, points FROM flags WHERE (? = '' OR team = ?) ORDER BY id;`
+const SELECT_CAPTURED_FLAGS_STATEMENT = `SELECT id, team, name, path, value, created_at, captured_at, captured_by, points FROM flags WHERE captured_at != 0 AND (? = 0 OR captured_at <= ?) ORDER BY captured_at, id;`
+const UPDATE_FLAG_CAPTURED_STATEMENT = `UPDATE flags SET captured_at = ?, captured_by = ?, points = ? WHERE id = ? AND captured_at = 0;`
+
+// DBFlag is a secret planted on a team's box for the red team to find. Once
+// captured it records who submitted it and how many points moved.
+type DBFlag struct {
+	ID         int64     `json:"id"`
+	Team       string    `json:"team"`
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Value      string    `json:"value"`
+	CreatedAt  time.Time `json:"created_at"`
+	CapturedAt time.Time `json:"captured_at"`
+	CapturedBy string    `json:"captured_by"`
+	Points     int       `json:"points"`
+}
+
+func (f *DBFlag) Captured() bool {
+	return !f.CapturedAt.IsZero()
+}
+
+func (f *DBFlag) JSON() []byte {
+	json, _ := json.Marshal(f)
+	return json
+}
+
+func scanFlag(scanner interface{ Scan(...any) error }) (*DBFlag, error) {
+	var flag DBFlag
+	var createdAt, capturedAt int64
+
+	if err := scanner.Scan(&flag.ID, &flag.Team, &flag.Name, &flag.Path, &flag.Value, &createdAt, &capturedAt, &flag.CapturedBy, &flag.Points); err != nil {
+		return nil, err
+	}
+
+	flag.CreatedAt = time.Unix(createdAt, 0)
+
+	if capturedAt != 0 {
+		flag.CapturedAt = time.Unix(capturedAt, 0)
+	}
+
+	return &flag, nil
+}
+
+func scanFlags(rows *sql.Rows) ([]*DBFlag, error) {
+	var flags []*DBFlag
+	for rows.Next() {
+		flag, err := scanFlag(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		flags = append(flags, flag)
+	}
+
+	return flags, nil
+}
+
+// ReplaceFlags stores the flags just planted on team's box, dropping any of
+// its earlier flags that were never captured.
+func ReplaceFlags(team string, flags []*DBFlag) error {
+	return QueuedTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(DELETE_UNCAPTURED_FLAGS_STATEMENT, team); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Prepare(INSERT_FLAG_STATEMENT)
+		if err != nil {
+			return err
+		}
+
+		defer stmt.Close()
+
+		for _, flag := range flags {
+			if flag.CreatedAt.IsZero() {
+				flag.CreatedAt = time.Now()
+			}
+
+			result, err := stmt.Exec(team, flag.Name, flag.Path, flag.Value, flag.CreatedAt.Unix())
+
+			if err != nil {
+				return err
+			}
+
+			if flag.ID, err = result.LastInsertId(); err != nil {
+				return err
+			}
+
+			flag.Team = team
+		}
+
+		return nil
+	})
+}
+
+// GetFlags returns every flag, or only team's when team is not empty.
+func GetFlags(team string) ([]*DBFlag, error) {
+	rows, err := QueuedQuery(SELECT_FLAGS_STATEMENT, team, team)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return scanFlags(rows)
+}
+
+// GetCapturedFlags returns the flags captured up to until, oldest first. A
+// zero until matches all.
+func GetCapturedFlags(until time.Time) ([]*DBFlag, error) {
+	var untilUnix int64
+
+	if !until.IsZero() {
+		untilUnix = until.Unix()
+	}
+
+	rows, err := QueuedQuery(SELECT_CAPTURED_FLAGS_STATEMENT, untilUnix, untilUnix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return scanFlags(rows)
+}
+
+// CaptureFlag records the capture of the flag with value by redTeam as a
+// transfer of points from the flag's team to redTeam, with an event for the
+// scoreboard, all in one transaction. A flag can only be captured once.
+func CaptureFlag(value, redTeam, actor string, points int) (*DBFlag, []*DBLedgerEntry, error) {
+	var flag *DBFlag
+	var entries []*DBLedgerEntry
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		var err error
+		flag, err = scanFlag(tx.QueryRow(SELECT_FLAG_BY_VALUE_STATEMENT, value))
+
+		if err == sql.ErrNoRows {
+			return ErrFlagNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if flag.Captured() {
+			return ErrFlagCaptured
+		}
+
+		flag.CapturedAt = time.Now()
+		flag.CapturedBy = actor
+		flag.Points = points
+
+		if _, err := tx.Exec(UPDATE_FLAG_CAPTURED_STATEMENT, flag.CapturedAt.Unix(), flag.CapturedBy, flag.Points, flag.ID); err != nil {
+			return err
+		}
+
+		var reason string = fmt.Sprintf("Flag %s captured on %s", flag.Name, flag.Team)
+
+		entries = []*DBLedgerEntry{{
+			Team:      redTeam,
+			Source:    LedgerSourceRedTeam,
+			Amount:    points,
+			Reason:    reason,
+			Actor:     actor,
+			CreatedAt: flag.CapturedAt,
+		}, {
+			Team:      flag.Team,
+			Source:    LedgerSourceRedTeam,
+			Amount:    -points,
+			Reason:    reason,
+			Actor:     actor,
+			CreatedAt: flag.CapturedAt,
+		}}
+
+		if err := insertLedgerEntries(tx, entries); err != nil {
+			return err
+		}
+
+		return insertEvents(tx, []*DBEvent{{
+			CreatedAt: flag.CapturedAt,
+			Kind:      EventKindFlagCaptured,
+			Team:      flag.Team,
+			Subject:   flag.Name,
+			Points:    -points,
+			Message:   fmt.Sprintf("%s captured flag %s on %s", redTeam, flag.Name, flag.Team),
+		}})
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return flag, entries, nil
+}
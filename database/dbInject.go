@@ -0,0 +1,364 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInjectNotFound = errors.New("inject not found")
+var ErrInjectClosed = errors.New("inject is past its due time")
+var ErrInjectSubmissionNotFound = errors.New("inject submission not found")
+var ErrInjectSubmissionGraded = errors.New("inject submission already graded")
+var ErrInvalidGrade = errors.New("invalid grade")
+
+const INSERT_INJECT_STATEMENT = `INSERT INTO injects (title, body, max_points, release_at, due_at, created_at, created_by) VALUES (?, ?, ?, ?, ?, ?, ?);`
+const SELECT_INJECT_STATEMENT = `SELECT id, title, body, max_points, release_at, due_at, created_at, created_by, released_at FROM injects WHERE id = ?;`
+const SELECT_INJECTS_STATEMENT = `SELECT id, title, body, max_points, release_at, due_at, created_at, created_by, released_at FROM injects WHERE (? = 0 OR release_at <= ?) ORDER BY release_at, id;`
+const SELECT_INJECTS_TO_RELEASE_STATEMENT = `SELECT id, title, body, max_points, release_at, due_at, created_at, created_by, released_at FROM injects WHERE released_at = 0 AND release_at <= ? ORDER BY release_at, id;`
+const UPDATE_INJECT_RELEASED_STATEMENT = `UPDATE injects SET released_at = ? WHERE id = ?;`
+
+const SELECT_INJECT_SUBMISSION_STATEMENT = `SELECT id, inject_id, team, response, submitted_at, points, comment, graded_at, graded_by, ledger_id FROM inject_submissions WHERE id = ?;`
+const SELECT_TEAM_INJECT_SUBMISSION_STATEMENT = `SELECT id, inject_id, team, response, submitted_at, points, comment, graded_at, graded_by, ledger_id FROM inject_submissions WHERE inject_id = ? AND team = ?;`
+const SELECT_INJECT_SUBMISSIONS_STATEMENT = `SELECT id, inject_id, team, response, submitted_at, points, comment, graded_at, graded_by, ledger_id FROM inject_submissions WHERE (? = 0 OR inject_id = ?) AND (? = '' OR team = ?) ORDER BY inject_id, team;`
+
+// A team may replace its response until the inject is due or graded
+const UPSERT_INJECT_SUBMISSION_STATEMENT = `INSERT INTO inject_submissions (inject_id, team, response, submitted_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT (inject_id, team) DO UPDATE SET response = excluded.response, submitted_at = excluded.submitted_at;`
+const UPDATE_INJECT_SUBMISSION_GRADE_STATEMENT = `UPDATE inject_submissions SET points = ?, comment = ?, graded_at = ?, graded_by = ?, ledger_id = ? WHERE id = ?;`
+
+// DBInject is a business task released to every team at ReleaseAt, answered
+// by DueAt and graded out of MaxPoints.
+type DBInject struct {
+	ID         int64     `json:"id"`
+	Title      string    `json:"title"`
+	Body       string    `json:"body"`
+	MaxPoints  int       `json:"max_points"`
+	ReleaseAt  time.Time `json:"release_at"`
+	DueAt      time.Time `json:"due_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	CreatedBy  string    `json:"created_by"`
+	ReleasedAt time.Time `json:"released_at"`
+}
+
+func (i *DBInject) JSON() []byte {
+	json, _ := json.Marshal(i)
+	return json
+}
+
+// DBInjectSubmission is a team's response to an inject. Once graded, the
+// points it earned are the ledger entry LedgerID.
+type DBInjectSubmission struct {
+	ID          int64     `json:"id"`
+	InjectID    int64     `json:"inject_id"`
+	Team        string    `json:"team"`
+	Response    string    `json:"response"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	Points      int       `json:"points"`
+	Comment     string    `json:"comment"`
+	GradedAt    time.Time `json:"graded_at"`
+	GradedBy    string    `json:"graded_by"`
+	LedgerID    int64     `json:"ledger_id"`
+}
+
+func (s *DBInjectSubmission) Graded() bool {
+	return !s.GradedAt.IsZero()
+}
+
+func (s *DBInjectSubmission) JSON() []byte {
+	json, _ := json.Marshal(s)
+	return json
+}
+
+func unixOrZero(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
+
+func scanInject(scanner interface{ Scan(...any) error }) (*DBInject, error) {
+	var inject DBInject
+	var releaseAt, dueAt, createdAt, releasedAt int64
+
+	if err := scanner.Scan(&inject.ID, &inject.Title, &inject.Body, &inject.MaxPoints, &releaseAt, &dueAt, &createdAt, &inject.CreatedBy, &releasedAt); err != nil {
+		return nil, err
+	}
+
+	inject.ReleaseAt = time.Unix(releaseAt, 0)
+	inject.DueAt = time.Unix(dueAt, 0)
+	inject.CreatedAt = time.Unix(createdAt, 0)
+	inject.ReleasedAt = unixOrZero(releasedAt)
+
+	return &inject, nil
+}
+
+func scanInjects(rows *sql.Rows) ([]*DBInject, error) {
+	var injects []*DBInject
+	for rows.Next() {
+		inject, err := scanInject(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		injects = append(injects, inject)
+	}
+
+	return injects, nil
+}
+
+func scanInjectSubmission(scanner interface{ Scan(...any) error }) (*DBInjectSubmission, error) {
+	var submission DBInjectSubmission
+	var submittedAt, gradedAt int64
+
+	if err := scanner.Scan(&submission.ID, &submission.InjectID, &submission.Team, &submission.Response, &submittedAt, &submission.Points, &submission.Comment, &gradedAt, &submission.GradedBy, &submission.LedgerID); err != nil {
+		return nil, err
+	}
+
+	submission.SubmittedAt = time.Unix(submittedAt, 0)
+	submission.GradedAt = unixOrZero(gradedAt)
+
+	return &submission, nil
+}
+
+func CreateInject(inject *DBInject) error {
+	if inject.CreatedAt.IsZero() {
+		inject.CreatedAt = time.Now()
+	}
+
+	id, err := QueuedInsert(INSERT_INJECT_STATEMENT, inject.Title, inject.Body, inject.MaxPoints, inject.ReleaseAt.Unix(), inject.DueAt.Unix(), inject.CreatedAt.Unix(), inject.CreatedBy)
+
+	if err != nil {
+		return err
+	}
+
+	inject.ID = id
+	return nil
+}
+
+func GetInject(id int64) (*DBInject, error) {
+	inject, err := scanInject(QueuedQueryRow(SELECT_INJECT_STATEMENT, id))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrInjectNotFound
+	}
+
+	return inject, err
+}
+
+// GetInjects returns the injects released by releasedBy, or every inject if
+// it is zero, in release order.
+func GetInjects(releasedBy time.Time) ([]*DBInject, error) {
+	var unix int64
+
+	if !releasedBy.IsZero() {
+		unix = releasedBy.Unix()
+	}
+
+	rows, err := QueuedQuery(SELECT_INJECTS_STATEMENT, unix, unix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return scanInjects(rows)
+}
+
+// ReleaseInjects marks the injects whose release time has come as released
+// and raises an event for each, returning them.
+func ReleaseInjects(now time.Time) ([]*DBInject, error) {
+	var injects []*DBInject
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query(SELECT_INJECTS_TO_RELEASE_STATEMENT, now.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		injects, err = scanInjects(rows)
+		rows.Close()
+
+		if err != nil || len(injects) == 0 {
+			return err
+		}
+
+		var events []*DBEvent = make([]*DBEvent, len(injects))
+
+		for i, inject := range injects {
+			if _, err := tx.Exec(UPDATE_INJECT_RELEASED_STATEMENT, now.Unix(), inject.ID); err != nil {
+				return err
+			}
+
+			inject.ReleasedAt = now
+
+			events[i] = &DBEvent{
+				CreatedAt: now,
+				Kind:      EventKindInjectReleased,
+				Subject:   inject.Title,
+				Message:   fmt.Sprintf("Inject %d released: %s, worth up to %d points, due %s", inject.ID, inject.Title, inject.MaxPoints, inject.DueAt.Format(time.RFC3339)),
+			}
+		}
+
+		return insertEvents(tx, events)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return injects, nil
+}
+
+// SubmitInject stores team's response to inject id, replacing an earlier
+// response that was not graded yet. Injects that are not released yet are
+// reported as not found.
+func SubmitInject(id int64, team, response string, now time.Time) (*DBInjectSubmission, error) {
+	var submission *DBInjectSubmission
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		inject, err := scanInject(tx.QueryRow(SELECT_INJECT_STATEMENT, id))
+
+		if err == sql.ErrNoRows || (err == nil && now.Before(inject.ReleaseAt)) {
+			return ErrInjectNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if now.After(inject.DueAt) {
+			return ErrInjectClosed
+		}
+
+		existing, err := scanInjectSubmission(tx.QueryRow(SELECT_TEAM_INJECT_SUBMISSION_STATEMENT, id, team))
+
+		if err == nil && existing.Graded() {
+			return ErrInjectSubmissionGraded
+		} else if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if _, err := tx.Exec(UPSERT_INJECT_SUBMISSION_STATEMENT, id, team, response, now.Unix()); err != nil {
+			return err
+		}
+
+		submission, err = scanInjectSubmission(tx.QueryRow(SELECT_TEAM_INJECT_SUBMISSION_STATEMENT, id, team))
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return submission, nil
+}
+
+// GetInjectSubmissions returns the submissions to inject id by team. A zero
+// id or empty team matches all.
+func GetInjectSubmissions(id int64, team string) ([]*DBInjectSubmission, error) {
+	rows, err := QueuedQuery(SELECT_INJECT_SUBMISSIONS_STATEMENT, id, id, team, team)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var submissions []*DBInjectSubmission
+	for rows.Next() {
+		submission, err := scanInjectSubmission(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		submissions = append(submissions, submission)
+	}
+
+	return submissions, nil
+}
+
+// GradeInjectSubmission awards points, out of the inject's maximum, to
+// submission id as an inject ledger entry. Grading it again reverts the
+// entry of the earlier grade, so only the latest grade counts.
+func GradeInjectSubmission(id int64, points int, comment, actor string) (*DBInjectSubmission, []*DBLedgerEntry, error) {
+	var submission *DBInjectSubmission
+	var entries []*DBLedgerEntry
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		var err error
+		submission, err = scanInjectSubmission(tx.QueryRow(SELECT_INJECT_SUBMISSION_STATEMENT, id))
+
+		if err == sql.ErrNoRows {
+			return ErrInjectSubmissionNotFound
+		} else if err != nil {
+			return err
+		}
+
+		inject, err := scanInject(tx.QueryRow(SELECT_INJECT_STATEMENT, submission.InjectID))
+
+		if err == sql.ErrNoRows {
+			return ErrInjectNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if points < 0 || points > inject.MaxPoints {
+			return fmt.Errorf("%w: points must be between 0 and %d", ErrInvalidGrade, inject.MaxPoints)
+		}
+
+		if submission.LedgerID != 0 {
+			previous, err := scanLedgerEntry(tx.QueryRow(SELECT_LEDGER_ENTRY_STATEMENT, submission.LedgerID))
+
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+
+			if err == nil && previous.RevertedBy == 0 {
+				entries = append(entries, &DBLedgerEntry{
+					Team:    previous.Team,
+					Source:  LedgerSourceRevert,
+					Amount:  -previous.Amount,
+					Reason:  fmt.Sprintf("Inject %d regraded", inject.ID),
+					Actor:   actor,
+					Reverts: previous.ID,
+				})
+			}
+		}
+
+		var grade *DBLedgerEntry = &DBLedgerEntry{
+			Team:   submission.Team,
+			Source: LedgerSourceInject,
+			Amount: points,
+			Reason: fmt.Sprintf("Inject %d: %s", inject.ID, inject.Title),
+			Actor:  actor,
+		}
+
+		if points != 0 {
+			entries = append(entries, grade)
+		}
+
+		if err := insertLedgerEntries(tx, entries); err != nil {
+			return err
+		}
+
+		submission.Points = points
+		submission.Comment = comment
+		submission.GradedAt = time.Now()
+		submission.GradedBy = actor
+		submission.LedgerID = grade.ID
+
+		_, err = tx.Exec(UPDATE_INJECT_SUBMISSION_GRADE_STATEMENT, submission.Points, submission.Comment, submission.GradedAt.Unix(), submission.GradedBy, submission.LedgerID, submission.ID)
+		return err
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return submission, entries, nil
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrLedgerEntryNotFound = errors.New("ledger entry not found")
+var ErrLedgerEntryReverted = errors.New("ledger entry already reverted")
+var ErrLedgerRevertOfRevert = errors.New("cannot revert a revert")
+
+const (
+	LedgerSourceOpening   = "opening"
+	LedgerSourceCheck     = "check"
+	LedgerSourceSLA       = "sla"
+	LedgerSourceOwnership = "ownership"
+	LedgerSourceManual    = "manual"
+	LedgerSourceInject    = "inject"
+	LedgerSourceRevert    = "revert"
+	LedgerSourceRescore   = "rescore"
+	LedgerSourceRedTeam   = "redteam"
+	LedgerSourceBoxRevert = "box_revert"
+)
+
+// LedgerActorSystem is the actor of entries made by scoring itself
+const LedgerActorSystem = "system"
+
+const INSERT_LEDGER_STATEMENT = `INSERT INTO ledger (team, source, amount, reason, actor, created_at, round_id, reverts) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+const SELECT_LEDGER_ENTRY_STATEMENT = `SELECT id, team, source, amount, reason, actor, created_at, round_id, reverts, (SELECT r.id FROM ledger r WHERE r.reverts = l.id) FROM ledger l WHERE id = ?;`
+const SELECT_LEDGER_ENTRIES_STATEMENT = `SELECT id, team, source, amount, reason, actor, created_at, round_id, reverts, (SELECT r.id FROM ledger r WHERE r.reverts = l.id) FROM ledger l WHERE (? = '' OR team = ?) AND (? = '' OR source = ?) ORDER BY id DESC LIMIT ?;`
+const SELECT_LEDGER_TOTALS_STATEMENT = `SELECT team, SUM(amount) FROM ledger GROUP BY team;`
+
+// DBLedgerEntry is a single change to a team's score. A team's score is the
+// sum of its entries. Entries are never edited; reverting one adds an entry
+// for the opposite amount that points back at it through Reverts.
+type DBLedgerEntry struct {
+	ID         int64     `json:"id"`
+	Team       string    `json:"team"`
+	Source     string    `json:"source"`
+	Amount     int       `json:"amount"`
+	Reason     string    `json:"reason"`
+	Actor      string    `json:"actor"`
+	CreatedAt  time.Time `json:"created_at"`
+	RoundID    int64     `json:"round_id"`
+	Reverts    int64     `json:"reverts"`
+	RevertedBy int64     `json:"reverted_by"`
+}
+
+func (l *DBLedgerEntry) JSON() []byte {
+	json, _ := json.Marshal(l)
+	return json
+}
+
+func insertLedgerEntries(tx *sql.Tx, entries []*DBLedgerEntry) error {
+	stmt, err := tx.Prepare(INSERT_LEDGER_STATEMENT)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = time.Now()
+		}
+
+		result, err := stmt.Exec(entry.Team, entry.Source, entry.Amount, entry.Reason, entry.Actor, entry.CreatedAt.Unix(), entry.RoundID, entry.Reverts)
+
+		if err != nil {
+			return err
+		}
+
+		if entry.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func CreateLedgerEntries(entries []*DBLedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return QueuedTransaction(func(tx *sql.Tx) error {
+		return insertLedgerEntries(tx, entries)
+	})
+}
+
+func scanLedgerEntry(scanner interface{ Scan(...any) error }) (*DBLedgerEntry, error) {
+	var entry DBLedgerEntry
+	var createdAt int64
+	var revertedBy sql.NullInt64
+
+	if err := scanner.Scan(&entry.ID, &entry.Team, &entry.Source, &entry.Amount, &entry.Reason, &entry.Actor, &createdAt, &entry.RoundID, &entry.Reverts, &revertedBy); err != nil {
+		return nil, err
+	}
+
+	entry.CreatedAt = time.Unix(createdAt, 0)
+	entry.RevertedBy = revertedBy.Int64
+
+	return &entry, nil
+}
+
+func GetLedgerEntry(id int64) (*DBLedgerEntry, error) {
+	rows, err := QueuedQuery(SELECT_LEDGER_ENTRY_STATEMENT, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrLedgerEntryNotFound
+	}
+
+	return scanLedgerEntry(rows)
+}
+
+// GetLedgerEntries returns up to limit entries, newest first. An empty team
+// or source matches all.
+func GetLedgerEntries(team, source string, limit int) ([]*DBLedgerEntry, error) {
+	rows, err := QueuedQuery(SELECT_LEDGER_ENTRIES_STATEMENT, team, team, source, source, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []*DBLedgerEntry
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// RevertLedgerEntry cancels entry id by adding an entry for the opposite
+// amount. An entry can only be reverted once.
+func RevertLedgerEntry(id int64, actor, reason string) (*DBLedgerEntry, error) {
+	var revert *DBLedgerEntry
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		entry, err := scanLedgerEntry(tx.QueryRow(SELECT_LEDGER_ENTRY_STATEMENT, id))
+
+		if err == sql.ErrNoRows {
+			return ErrLedgerEntryNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if entry.Reverts != 0 {
+			return ErrLedgerRevertOfRevert
+		}
+
+		if entry.RevertedBy != 0 {
+			return ErrLedgerEntryReverted
+		}
+
+		revert = &DBLedgerEntry{
+			Team:    entry.Team,
+			Source:  LedgerSourceRevert,
+			Amount:  -entry.Amount,
+			Reason:  reason,
+			Actor:   actor,
+			RoundID: entry.RoundID,
+			Reverts: entry.ID,
+		}
+
+		return insertLedgerEntries(tx, []*DBLedgerEntry{revert})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return revert, nil
+}
+
+// GetLedgerTotals returns every team's score as the sum of its entries.
+func GetLedgerTotals() (map[string]int, error) {
+	rows, err := QueuedQuery(SELECT_LEDGER_TOTALS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var totals map[string]int = make(map[string]int)
+	for rows.Next() {
+		var team string
+		var total int
+
+		if err := rows.Scan(&team, &total); err != nil {
+			return nil, err
+		}
+
+		totals[team] = total
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+const (
+	OwnershipRoleDefender = "defender"
+	OwnershipRoleAttacker = "attacker"
+)
+
+const INSERT_OWNERSHIP_STATEMENT = `INSERT INTO ownership (round_id, hill, owner, role, points) VALUES (?, ?, ?, ?, ?);`
+const SELECT_LATEST_OWNERSHIP_STATEMENT = `SELECT o.round_id, o.hill, o.owner, o.role, o.points FROM ownership o WHERE o.round_id = (SELECT MAX(l.round_id) FROM ownership l WHERE l.hill = o.hill);`
+
+// Void rounds awarded nothing, so their ownership does not count
+const SELECT_OWNERSHIP_TOTALS_STATEMENT = `SELECT owner, role, COUNT(*), SUM(points) FROM ownership WHERE round_id NOT IN (SELECT id FROM rounds WHERE voided_at != 0) GROUP BY owner, role;`
+
+// DBOwnership records which team held a hill during a round. Role is
+// OwnershipRoleDefender when the owner is the hill's own team.
+type DBOwnership struct {
+	RoundID int64  `json:"round_id"`
+	Hill    string `json:"hill"`
+	Owner   string `json:"owner"`
+	Role    string `json:"role"`
+	Points  int    `json:"points"`
+}
+
+func (o *DBOwnership) JSON() []byte {
+	json, _ := json.Marshal(o)
+	return json
+}
+
+type DBOwnershipTotal struct {
+	Team   string `json:"team"`
+	Role   string `json:"role"`
+	Rounds int    `json:"rounds"`
+	Points int    `json:"points"`
+}
+
+func CreateOwnerships(ownerships []*DBOwnership) error {
+	return QueuedTransaction(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(INSERT_OWNERSHIP_STATEMENT)
+		if err != nil {
+			return err
+		}
+
+		defer stmt.Close()
+
+		for _, ownership := range ownerships {
+			if _, err := stmt.Exec(ownership.RoundID, ownership.Hill, ownership.Owner, ownership.Role, ownership.Points); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetLatestOwnerships returns the most recent claim recorded for every hill.
+func GetLatestOwnerships() ([]*DBOwnership, error) {
+	rows, err := QueuedQuery(SELECT_LATEST_OWNERSHIP_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ownerships []*DBOwnership
+	for rows.Next() {
+		var ownership DBOwnership
+		if err := rows.Scan(&ownership.RoundID, &ownership.Hill, &ownership.Owner, &ownership.Role, &ownership.Points); err != nil {
+			return nil, err
+		}
+
+		ownerships = append(ownerships, &ownership)
+	}
+
+	return ownerships, nil
+}
+
+func GetOwnershipTotals() ([]*DBOwnershipTotal, error) {
+	rows, err := QueuedQuery(SELECT_OWNERSHIP_TOTALS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var totals []*DBOwnershipTotal
+	for rows.Next() {
+		var total DBOwnershipTotal
+		if err := rows.Scan(&total.Team, &total.Role, &total.Rounds, &total.Points); err != nil {
+			return nil, err
+		}
+
+		totals = append(totals, &total)
+	}
+
+	return totals, nil
+}
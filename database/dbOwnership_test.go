@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOwnershipTotalsSkipVoidRounds(t *testing.T) {
+	openTestDatabase(t)
+
+	var start time.Time = time.Unix(1700000000, 0)
+	first := finishedRound(t, start)
+	second := finishedRound(t, start.Add(time.Minute))
+
+	if err := CreateOwnerships([]*DBOwnership{
+		{RoundID: first.ID, Hill: "alpha", Owner: "alpha", Role: OwnershipRoleDefender, Points: 5},
+		{RoundID: second.ID, Hill: "alpha", Owner: "alpha", Role: OwnershipRoleDefender, Points: 5},
+		{RoundID: second.ID, Hill: "bravo", Owner: "alpha", Role: OwnershipRoleAttacker, Points: 5},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VoidRound(second.ID, "admin", "scorer lost its route"); err != nil {
+		t.Fatal(err)
+	}
+
+	totals, err := GetOwnershipTotals()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(totals) != 1 {
+		t.Fatalf("expected only the defended total of the first round, got %d totals", len(totals))
+	}
+
+	if total := totals[0]; total.Team != "alpha" || total.Role != OwnershipRoleDefender || total.Rounds != 1 || total.Points != 5 {
+		t.Fatalf("unexpected total %+v", total)
+	}
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrRoundNotFound = errors.New("round not found")
+var ErrRoundAlreadyVoid = errors.New("round already void")
+var ErrRoundRunning = errors.New("round is still running")
+
+const INSERT_ROUND_STATEMENT = `INSERT INTO rounds (started_at) VALUES (?);`
+const SELECT_ROUND_STATEMENT = `SELECT id, started_at, finished_at, voided_at, void_reason FROM rounds WHERE id = ?;`
+const UPDATE_ROUND_FINISHED_STATEMENT = `UPDATE rounds SET finished_at = ? WHERE id = ?;`
+const UPDATE_ROUND_VOID_STATEMENT = `UPDATE rounds SET voided_at = ?, void_reason = ? WHERE id = ?;`
+const SELECT_ROUNDS_IN_RANGE_STATEMENT = `SELECT id, started_at, finished_at, voided_at, void_reason FROM rounds WHERE finished_at != 0 AND started_at >= ? AND started_at <= ? ORDER BY id DESC LIMIT ?;`
+const SELECT_VOID_ROUND_IDS_STATEMENT = `SELECT id FROM rounds WHERE voided_at != 0;`
+
+// SELECT_ROUND_LEDGER_STATEMENT lists the entries a round added that are
+// still in effect
+const SELECT_ROUND_LEDGER_STATEMENT = `SELECT l.id, l.team, l.source, l.amount, l.reason, l.actor, l.created_at, l.round_id, l.reverts, 0 FROM ledger l WHERE l.round_id = ? AND l.reverts = 0 AND l.source != 'revert' AND NOT EXISTS (SELECT 1 FROM ledger r WHERE r.reverts = l.id);`
+
+// DBRound is one scoring round. A void round, e.g. one where the scorer
+// itself was broken, awards no points.
+type DBRound struct {
+	ID         int64     `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	VoidedAt   time.Time `json:"voided_at"`
+	VoidReason string    `json:"void_reason"`
+}
+
+func (r *DBRound) Void() bool {
+	return !r.VoidedAt.IsZero()
+}
+
+func (r *DBRound) JSON() []byte {
+	json, _ := json.Marshal(r)
+	return json
+}
+
+func scanRound(scanner interface{ Scan(...any) error }) (*DBRound, error) {
+	var round DBRound
+	var startedAt, finishedAt, voidedAt int64
+
+	if err := scanner.Scan(&round.ID, &startedAt, &finishedAt, &voidedAt, &round.VoidReason); err != nil {
+		return nil, err
+	}
+
+	round.StartedAt = time.Unix(startedAt, 0)
+
+	if finishedAt != 0 {
+		round.FinishedAt = time.Unix(finishedAt, 0)
+	}
+
+	if voidedAt != 0 {
+		round.VoidedAt = time.Unix(voidedAt, 0)
+	}
+
+	return &round, nil
+}
+
+func CreateRound(startedAt time.Time) (*DBRound, error) {
+	id, err := QueuedInsert(INSERT_ROUND_STATEMENT, startedAt.Unix())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DBRound{
+		ID:        id,
+		StartedAt: time.Unix(startedAt.Unix(), 0),
+	}, nil
+}
+
+func GetRound(id int64) (*DBRound, error) {
+	rows, err := QueuedQuery(SELECT_ROUND_STATEMENT, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrRoundNotFound
+	}
+
+	return scanRound(rows)
+}
+
+func FinishRound(round *DBRound, finishedAt time.Time) error {
+	round.FinishedAt = time.Unix(finishedAt.Unix(), 0)
+	return QueuedExec(UPDATE_ROUND_FINISHED_STATEMENT, finishedAt.Unix(), round.ID)
+}
+
+// GetRoundsInRange returns at most limit finished rounds started within
+// [from, to], newest first. The round still running is left out, it has not
+// been scored yet.
+func GetRoundsInRange(from, to time.Time, limit int) ([]*DBRound, error) {
+	rows, err := QueuedQuery(SELECT_ROUNDS_IN_RANGE_STATEMENT, from.Unix(), to.Unix(), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var rounds []*DBRound
+	for rows.Next() {
+		round, err := scanRound(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rounds = append(rounds, round)
+	}
+
+	return rounds, nil
+}
+
+// VoidRound marks a finished round void and reverts every ledger entry it
+// added, all in one transaction. It returns the reverting entries. A round
+// that is still running could add entries after the void, so it is refused.
+func VoidRound(id int64, actor, reason string) ([]*DBLedgerEntry, error) {
+	var reverts []*DBLedgerEntry
+
+	err := QueuedTransaction(func(tx *sql.Tx) error {
+		reverts = nil
+
+		round, err := scanRound(tx.QueryRow(SELECT_ROUND_STATEMENT, id))
+
+		if err == sql.ErrNoRows {
+			return ErrRoundNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if round.Void() {
+			return ErrRoundAlreadyVoid
+		}
+
+		if round.FinishedAt.IsZero() {
+			return ErrRoundRunning
+		}
+
+		if _, err := tx.Exec(UPDATE_ROUND_VOID_STATEMENT, time.Now().Unix(), reason, id); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(SELECT_ROUND_LEDGER_STATEMENT, id)
+
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			entry, err := scanLedgerEntry(rows)
+
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			reverts = append(reverts, &DBLedgerEntry{
+				Team:    entry.Team,
+				Source:  LedgerSourceRevert,
+				Amount:  -entry.Amount,
+				Reason:  fmt.Sprintf("Round %d void: %s", id, reason),
+				Actor:   actor,
+				RoundID: id,
+				Reverts: entry.ID,
+			})
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		return insertLedgerEntries(tx, reverts)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reverts, nil
+}
@@ -8,17 +8,6 @@ import (
 var ErrTeamExists = errors.New("team already exists")
 var ErrTeamNotFound = errors.New("team not found")
 
-const TEAMS_STATEMENT = `CREATE TABLE IF NOT EXISTS teams (
-	name TEXT PRIMARY KEY NOT NULL,
-	container_ip TEXT NOT NULL,
-	container_id INTEGER NOT NULL,
-	score INTEGER NOT NULL,
-	uptimeChecksTotal INTEGER DEFAULT 0,
-	uptimeChecksPassed INTEGER DEFAULT 0,
-	serviceChecksTotal INTEGER DEFAULT 0,
-	serviceChecksPassed INTEGER DEFAULT 0
-);`
-
 const INSERT_TEAM_STATEMENT = `INSERT INTO teams (name, container_ip, container_id, score) VALUES (?, ?, ?, ?);`
 const SELECT_TEAM_STATEMENT = `SELECT name, container_ip, container_id, score, uptimeChecksTotal, uptimeChecksPassed, serviceChecksTotal, serviceChecksPassed FROM teams WHERE name = ?;`
 const DELETE_TEAM_STATEMENT = `DELETE FROM teams WHERE name = ?;`
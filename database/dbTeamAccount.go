@@ -0,0 +1,31 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrTeamAccountNotFound = errors.New("team account not found")
+
+const UPSERT_TEAM_ACCOUNT_STATEMENT = `INSERT INTO team_accounts (team, password_hash, updated_at) VALUES (?, ?, ?)
+	ON CONFLICT (team) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at;`
+const SELECT_TEAM_ACCOUNT_HASH_STATEMENT = `SELECT password_hash FROM team_accounts WHERE team = ?;`
+
+// SetTeamPasswordHash stores the hash of team's portal password, replacing
+// any earlier one.
+func SetTeamPasswordHash(team, hash string) error {
+	return QueuedExec(UPSERT_TEAM_ACCOUNT_STATEMENT, team, hash, time.Now().Unix())
+}
+
+func GetTeamPasswordHash(team string) (string, error) {
+	var hash string
+
+	if err := QueuedQueryRow(SELECT_TEAM_ACCOUNT_HASH_STATEMENT, team).Scan(&hash); err == sql.ErrNoRows {
+		return "", ErrTeamAccountNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
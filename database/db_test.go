@@ -0,0 +1,46 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// openTestDatabase points the package at a new, migrated database in a
+// temporary directory.
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+
+	lib.Config.Database.File = filepath.Join(t.TempDir(), "koth.db")
+
+	if err := Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// finishedRound creates a round that has already finished.
+func finishedRound(t *testing.T, startedAt time.Time) *DBRound {
+	t.Helper()
+
+	round, err := CreateRound(startedAt)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := FinishRound(round, startedAt.Add(30*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	return round
+}
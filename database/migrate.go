@@ -0,0 +1,202 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are applied in order of the number their file name starts with,
+// e.g. 0002_add_team_notes.sql. A migration that was applied must never be
+// edited; change the schema again with a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const SCHEMA_VERSION_STATEMENT = `CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY NOT NULL,
+	name TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+);`
+
+const SELECT_SCHEMA_VERSION_EXISTS_STATEMENT = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version';`
+const SELECT_SCHEMA_VERSIONS_STATEMENT = `SELECT version, name, applied_at FROM schema_version ORDER BY version;`
+const INSERT_SCHEMA_VERSION_STATEMENT = `INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?);`
+
+// Migration is one embedded schema change. AppliedAt is zero while it is
+// still pending.
+type Migration struct {
+	Version   int
+	Name      string
+	SQL       string
+	AppliedAt time.Time
+}
+
+func (m *Migration) Applied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+// loadMigrations parses the embedded migrations, ordered by version.
+func loadMigrations() ([]*Migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+
+	for _, file := range files {
+		number, name, ok := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(number)
+
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", file.Name())
+		}
+
+		raw, err := migrationFiles.ReadFile(path.Join("migrations", file.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, &Migration{
+			Version: version,
+			Name:    name,
+			SQL:     string(raw),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", migrations[i-1].Name, migrations[i].Name, migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrations returns every embedded migration, with when it was applied to
+// the open database if it was. It only reads the database, one without a
+// schema_version table has every migration pending.
+func Migrations() ([]*Migration, error) {
+	migrations, err := loadMigrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var exists int
+
+	if err := db.QueryRow(SELECT_SCHEMA_VERSION_EXISTS_STATEMENT).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return migrations, nil
+	}
+
+	rows, err := db.Query(SELECT_SCHEMA_VERSIONS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var byVersion map[int]*Migration = make(map[int]*Migration, len(migrations))
+
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	for rows.Next() {
+		var version int
+		var name string
+		var appliedAt int64
+
+		if err := rows.Scan(&version, &name, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+
+		if !ok {
+			return nil, fmt.Errorf("database has migration %d (%s) which this build does not know, it was made by a newer build", version, name)
+		}
+
+		migration.AppliedAt = time.Unix(appliedAt, 0)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations in order, each in its own
+// transaction along with its schema_version row, and returns the ones it
+// applied.
+func Migrate() ([]*Migration, error) {
+	if _, err := db.Exec(SCHEMA_VERSION_STATEMENT); err != nil {
+		return nil, err
+	}
+
+	migrations, err := Migrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []*Migration
+
+	for _, migration := range migrations {
+		if migration.Applied() {
+			continue
+		}
+
+		if err := applyMigration(migration); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+func applyMigration(migration *Migration) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return err
+	}
+
+	var now time.Time = time.Now()
+
+	if _, err := tx.Exec(INSERT_SCHEMA_VERSION_STATEMENT, migration.Version, migration.Name, now.Unix()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	migration.AppliedAt = now
+	return nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+func TestMigrationsDoesNotWrite(t *testing.T) {
+	lib.Config.Database.File = filepath.Join(t.TempDir(), "koth.db")
+
+	if err := Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	migrations, err := Migrations()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Applied() {
+			t.Fatalf("migration %d is applied to a new database", migration.Version)
+		}
+	}
+
+	var exists int
+
+	if err := db.QueryRow(SELECT_SCHEMA_VERSION_EXISTS_STATEMENT).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists != 0 {
+		t.Fatal("listing migrations created the schema_version table")
+	}
+}
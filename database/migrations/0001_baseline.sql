@@ -0,0 +1,141 @@
+-- The schema as it was before migrations. Every statement is idempotent so
+-- that databases created by older builds can adopt it.
+
+CREATE TABLE IF NOT EXISTS teams (
+	name TEXT PRIMARY KEY NOT NULL,
+	container_ip TEXT NOT NULL,
+	container_id INTEGER NOT NULL,
+	score INTEGER NOT NULL,
+	uptimeChecksTotal INTEGER DEFAULT 0,
+	uptimeChecksPassed INTEGER DEFAULT 0,
+	serviceChecksTotal INTEGER DEFAULT 0,
+	serviceChecksPassed INTEGER DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS blobs (
+	name TEXT PRIMARY KEY NOT NULL,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS rounds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at INTEGER NOT NULL,
+	finished_at INTEGER NOT NULL DEFAULT 0,
+	voided_at INTEGER NOT NULL DEFAULT 0,
+	void_reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS check_results (
+	round_id INTEGER NOT NULL,
+	team TEXT NOT NULL,
+	check_name TEXT NOT NULL,
+	status TEXT NOT NULL,
+	points INTEGER NOT NULL,
+	latency_ms INTEGER NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL DEFAULT '',
+	evidence TEXT NOT NULL DEFAULT '',
+	multiplier REAL NOT NULL DEFAULT 1,
+	multipliers TEXT NOT NULL DEFAULT '',
+	credit REAL,
+	PRIMARY KEY (round_id, team, check_name)
+);
+
+CREATE INDEX IF NOT EXISTS check_results_team ON check_results (team, round_id);
+
+CREATE TABLE IF NOT EXISTS ownership (
+	round_id INTEGER NOT NULL,
+	hill TEXT NOT NULL,
+	owner TEXT NOT NULL,
+	role TEXT NOT NULL,
+	points INTEGER NOT NULL,
+	PRIMARY KEY (round_id, hill)
+);
+
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	round_id INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	team TEXT NOT NULL,
+	subject TEXT NOT NULL DEFAULT '',
+	points INTEGER NOT NULL DEFAULT 0,
+	message TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS events_round ON events (round_id);
+
+CREATE TABLE IF NOT EXISTS ledger (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	team TEXT NOT NULL,
+	source TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	actor TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	round_id INTEGER NOT NULL DEFAULT 0,
+	reverts INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS ledger_team ON ledger (team, id);
+
+-- Teams that scored before the ledger existed get their score carried over
+-- as an opening entry, so the ledger sum matches what they already had.
+INSERT INTO ledger (team, source, amount, reason, actor, created_at)
+	SELECT name, 'opening', score, 'Score before the ledger', 'system', CAST(strftime('%s', 'now') AS INTEGER) FROM teams
+	WHERE score != 0 AND name NOT IN (SELECT team FROM ledger);
+
+CREATE TABLE IF NOT EXISTS team_accounts (
+	team TEXT PRIMARY KEY NOT NULL,
+	password_hash TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS flags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	team TEXT NOT NULL,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL,
+	value TEXT NOT NULL UNIQUE,
+	created_at INTEGER NOT NULL,
+	captured_at INTEGER NOT NULL DEFAULT 0,
+	captured_by TEXT NOT NULL DEFAULT '',
+	points INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS injects (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+	max_points INTEGER NOT NULL,
+	release_at INTEGER NOT NULL,
+	due_at INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	released_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS inject_submissions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	inject_id INTEGER NOT NULL,
+	team TEXT NOT NULL,
+	response TEXT NOT NULL,
+	submitted_at INTEGER NOT NULL,
+	points INTEGER NOT NULL DEFAULT 0,
+	comment TEXT NOT NULL DEFAULT '',
+	graded_at INTEGER NOT NULL DEFAULT 0,
+	graded_by TEXT NOT NULL DEFAULT '',
+	ledger_id INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (inject_id, team)
+);
+
+CREATE TABLE IF NOT EXISTS box_reverts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	team TEXT NOT NULL,
+	requested_by TEXT NOT NULL,
+	requested_at INTEGER NOT NULL,
+	finished_at INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	cost INTEGER NOT NULL,
+	ledger_id INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,4 @@
+-- The check stats behind matrix.json look up every team and check's latest
+-- up result and the results after it, so they need the rounds of each team
+-- and check in order.
+CREATE INDEX IF NOT EXISTS check_results_team_check ON check_results (team, check_name, round_id);
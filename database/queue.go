@@ -135,3 +135,41 @@ func QueuedBegin() (*sql.Tx, error) {
 
 	return tx, err
 }
+
+func QueuedInsert(query string, args ...any) (int64, error) {
+	var id int64
+	err := GetQueue().EnqueueOperation(func() error {
+		stmt, err := db.Prepare(query)
+		if err != nil {
+			return err
+		}
+
+		defer stmt.Close()
+		result, err := stmt.Exec(args...)
+		if err != nil {
+			return err
+		}
+
+		id, err = result.LastInsertId()
+
+		return err
+	})
+
+	return id, err
+}
+
+func QueuedTransaction(operation func(tx *sql.Tx) error) error {
+	return GetQueue().EnqueueOperation(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err := operation(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,152 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// agentRequest sends a request to the head node, signed as
+// lib.Config.Agent.Name.
+func agentRequest(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(lib.Config.Agent.HeadURL, "/")+path, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var timestamp string = strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Koth-Agent", lib.Config.Agent.Name)
+	req.Header.Set("X-Koth-Timestamp", timestamp)
+	req.Header.Set("X-Koth-Signature", SignAgentRequest(lib.Config.Agent.Secret, lib.Config.Agent.Name, timestamp, body))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	response, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned status %d", method, path, res.StatusCode)
+	}
+
+	return response, nil
+}
+
+// RunAgent polls the head node for assignments and runs them from this host,
+// posting every result back as soon as it is known. It only returns on a
+// configuration error.
+func RunAgent() error {
+	if head, err := url.Parse(lib.Config.Agent.HeadURL); err != nil || (head.Scheme != "http" && head.Scheme != "https") || head.Host == "" {
+		return fmt.Errorf("invalid AGENT_HEAD_URL %q", lib.Config.Agent.HeadURL)
+	}
+
+	var checks map[string]Check = make(map[string]Check, len(ScoringChecks))
+
+	for _, check := range ScoringChecks {
+		checks[check.Name] = check
+	}
+
+	var lastRound int64
+
+	for ; ; time.Sleep(time.Second) {
+		response, err := agentRequest(http.MethodGet, "/api/agent/assignments", nil)
+
+		if err != nil {
+			lib.Log.Warning(fmt.Sprintf("Failed to fetch assignments: %s", err.Error()))
+			continue
+		}
+
+		var round AgentRound
+
+		if err := json.Unmarshal(response, &round); err != nil {
+			lib.Log.Warning(fmt.Sprintf("Invalid assignments: %s", err.Error()))
+			continue
+		}
+
+		if round.Round == 0 || round.Round == lastRound {
+			continue
+		}
+
+		lastRound = round.Round
+		lib.Log.Status(fmt.Sprintf("Running %d checks for round %d", len(round.Assignments), round.Round))
+
+		go runAgentRound(round, checks)
+	}
+}
+
+func runAgentRound(round AgentRound, checks map[string]Check) {
+	ctx, cancel := context.WithDeadline(context.Background(), round.Deadline)
+	defer cancel()
+
+	var env *Environment = &Environment{}
+	var wg sync.WaitGroup
+
+	for _, assignment := range round.Assignments {
+		check, ok := checks[assignment.Check]
+
+		if !ok {
+			lib.Log.Warning(fmt.Sprintf("Unknown check %q assigned, is the checks file in sync with the head node?", assignment.Check))
+			continue
+		}
+
+		wg.Add(1)
+		go func(assignment AgentAssignment) {
+			defer wg.Done()
+
+			waitUntil(ctx, round.StartedAt.Add(time.Duration(assignment.OffsetMS)*time.Millisecond))
+
+			result := env.RunCheck(ctx, check, &Container{
+				Team: &database.DBTeam{
+					Name:        assignment.Team,
+					ContainerIP: assignment.IP,
+				},
+			})
+
+			body, err := json.Marshal(AgentReport{
+				Round: round.Round,
+				Results: []AgentResult{{
+					Team:      assignment.Team,
+					Check:     assignment.Check,
+					Status:    result.Status,
+					LatencyMS: result.Latency.Milliseconds(),
+					Reason:    result.Reason,
+					Evidence:  result.Evidence,
+					Credit:    result.Credit,
+				}},
+			})
+
+			if err != nil {
+				return
+			}
+
+			if _, err := agentRequest(http.MethodPost, "/api/agent/results", body); err != nil {
+				lib.Log.Warning(fmt.Sprintf("[%s][%s]: Failed to report result: %s", assignment.Team, assignment.Check, err.Error()))
+			}
+		}(assignment)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,348 @@
+package environment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+const (
+	AgentMergeAny      = "any"
+	AgentMergeMajority = "majority"
+	AgentMergeAll      = "all"
+)
+
+// AgentLocal names the head node's own result among the agents' results.
+const AgentLocal = "head"
+
+// MaxAgentClockSkew is how far a signed request's timestamp may be from the
+// head node's clock.
+const MaxAgentClockSkew = 30 * time.Second
+
+var ErrAgentUnauthorized = errors.New("agent unauthorized")
+var ErrAgentStaleRound = errors.New("round is not running")
+
+// AgentAssignment asks agents to run Check against Team at Offset into the
+// round.
+type AgentAssignment struct {
+	Team     string `json:"team"`
+	IP       string `json:"ip"`
+	Check    string `json:"check"`
+	OffsetMS int64  `json:"offsetMs"`
+}
+
+// AgentRound is what agents poll for. Round is zero between rounds.
+type AgentRound struct {
+	Round       int64             `json:"round"`
+	StartedAt   time.Time         `json:"startedAt"`
+	Deadline    time.Time         `json:"deadline"`
+	Assignments []AgentAssignment `json:"assignments"`
+}
+
+type AgentResult struct {
+	Team      string  `json:"team"`
+	Check     string  `json:"check"`
+	Status    string  `json:"status"`
+	LatencyMS int64   `json:"latencyMs"`
+	Reason    string  `json:"reason"`
+	Evidence  string  `json:"evidence"`
+	Credit    float64 `json:"credit"`
+}
+
+// AgentReport is what an agent posts back for a round.
+type AgentReport struct {
+	Round   int64         `json:"round"`
+	Results []AgentResult `json:"results"`
+}
+
+// Agents collects the results remote agents report for the current round.
+type Agents struct {
+	Merge string
+	Local bool
+	Grace time.Duration
+
+	secrets map[string]string
+
+	mutex   sync.Mutex
+	round   AgentRound
+	results map[string]map[string]CheckResult
+	changed chan struct{}
+}
+
+// LoadAgents reads the agents the head node accepts from lib.Config.Agents.
+func LoadAgents() (*Agents, error) {
+	var agents *Agents = &Agents{
+		Merge:   lib.Config.Agents.Merge,
+		Local:   lib.Config.Agents.Local,
+		Grace:   lib.Config.Agents.Grace,
+		secrets: make(map[string]string),
+		changed: make(chan struct{}),
+	}
+
+	switch agents.Merge {
+	case AgentMergeAny, AgentMergeMajority, AgentMergeAll:
+	default:
+		return nil, fmt.Errorf("invalid agent merge rule %q, expected any, majority or all", agents.Merge)
+	}
+
+	if lib.Config.Agents.List != "" {
+		for _, pair := range strings.Split(lib.Config.Agents.List, ",") {
+			name, secret, ok := strings.Cut(strings.TrimSpace(pair), "=")
+
+			if !ok || name == "" || secret == "" {
+				return nil, fmt.Errorf("invalid agent %q, expected name=secret", pair)
+			}
+
+			if name == AgentLocal || agents.secrets[name] != "" {
+				return nil, fmt.Errorf("agent name %q is reserved or used twice", name)
+			}
+
+			agents.secrets[name] = secret
+		}
+	}
+
+	if !agents.Local && len(agents.secrets) == 0 {
+		return nil, fmt.Errorf("AGENTS_LOCAL=false requires at least one agent")
+	}
+
+	return agents, nil
+}
+
+// Enabled reports whether any remote agent is configured.
+func (a *Agents) Enabled() bool {
+	return a != nil && len(a.secrets) > 0
+}
+
+// SignAgentRequest signs a request from agent, sent at timestamp (Unix
+// seconds), with the agent's secret.
+func SignAgentRequest(secret, agent, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(agent + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that a request was signed by agent recently.
+func (a *Agents) Verify(agent, timestamp, signature string, body []byte) error {
+	secret, ok := a.secrets[agent]
+
+	if !ok {
+		return ErrAgentUnauthorized
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return ErrAgentUnauthorized
+	}
+
+	if skew := time.Since(time.Unix(unix, 0)); skew > MaxAgentClockSkew || skew < -MaxAgentClockSkew {
+		return ErrAgentUnauthorized
+	}
+
+	if !hmac.Equal([]byte(SignAgentRequest(secret, agent, timestamp, body)), []byte(signature)) {
+		return ErrAgentUnauthorized
+	}
+
+	return nil
+}
+
+func agentResultKey(team, check string) string {
+	return team + "\x00" + check
+}
+
+func (a *Agents) startRound(round AgentRound) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.round = round
+	a.results = make(map[string]map[string]CheckResult)
+}
+
+func (a *Agents) endRound() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.round = AgentRound{}
+	a.results = nil
+}
+
+// Assignments returns the checks agents should run this round.
+func (a *Agents) Assignments() AgentRound {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.round
+}
+
+// Report stores results from agent for the current round. Results for checks
+// that were not assigned are ignored.
+func (a *Agents) Report(agent string, report AgentReport) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.round.Round == 0 || report.Round != a.round.Round {
+		return ErrAgentStaleRound
+	}
+
+	for _, result := range report.Results {
+		if !slices.ContainsFunc(a.round.Assignments, func(assignment AgentAssignment) bool {
+			return assignment.Team == result.Team && assignment.Check == result.Check
+		}) {
+			continue
+		}
+
+		switch result.Status {
+		case database.CheckStatusUp, database.CheckStatusDown, database.CheckStatusTimeout, database.CheckStatusPartial:
+		default:
+			continue
+		}
+
+		key := agentResultKey(result.Team, result.Check)
+
+		if a.results[key] == nil {
+			a.results[key] = make(map[string]CheckResult)
+		}
+
+		a.results[key][agent] = CheckResult{
+			Status:   result.Status,
+			Latency:  time.Duration(result.LatencyMS) * time.Millisecond,
+			Reason:   result.Reason,
+			Evidence: truncateEvidence(result.Evidence),
+			Credit:   min(max(result.Credit, 0), 1),
+		}
+	}
+
+	close(a.changed)
+	a.changed = make(chan struct{})
+
+	return nil
+}
+
+// collect waits until every agent reported check for team, or until until.
+func (a *Agents) collect(ctx context.Context, team, check string, until time.Time) map[string]CheckResult {
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+
+	for {
+		a.mutex.Lock()
+		var votes map[string]CheckResult = make(map[string]CheckResult)
+
+		for agent, result := range a.results[agentResultKey(team, check)] {
+			votes[agent] = result
+		}
+
+		changed := a.changed
+		a.mutex.Unlock()
+
+		if len(votes) >= len(a.secrets) {
+			return votes
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return votes
+		case <-ctx.Done():
+			return votes
+		}
+	}
+}
+
+func agentStatusRank(status string) int {
+	switch status {
+	case database.CheckStatusUp:
+		return 3
+	case database.CheckStatusPartial:
+		return 2
+	case database.CheckStatusDown:
+		return 1
+	}
+
+	return 0
+}
+
+// mergeAgentResults combines the results from every vantage point that
+// reported. With "any" the best result counts, with "all" the worst, and with
+// "majority" the best result that more than half of them matched or beat.
+func mergeAgentResults(rule string, votes map[string]CheckResult) CheckResult {
+	if len(votes) == 0 {
+		return CheckResult{Status: database.CheckStatusTimeout, Reason: "no agent reported a result"}
+	}
+
+	var names []string = make([]string, 0, len(votes))
+
+	for name := range votes {
+		names = append(names, name)
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		if rank := agentStatusRank(votes[b].Status) - agentStatusRank(votes[a].Status); rank != 0 {
+			return rank
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	var pick int
+
+	switch rule {
+	case AgentMergeMajority:
+		pick = len(names) / 2
+	case AgentMergeAll:
+		pick = len(names) - 1
+	}
+
+	var merged CheckResult = votes[names[pick]]
+
+	if votes[names[0]].Status != votes[names[len(names)-1]].Status {
+		var summary []string = make([]string, len(names))
+
+		for i, name := range names {
+			summary[i] = name + " " + votes[name].Status
+		}
+
+		if merged.Reason != "" {
+			merged.Reason += "; "
+		}
+
+		merged.Reason += "vantage points: " + strings.Join(summary, ", ")
+	}
+
+	return merged
+}
+
+// runCheckWithAgents runs check from the head node and/or waits for the
+// agents' results, and merges them. deadline is the latest the agents'
+// results are waited for.
+func (e *Environment) runCheckWithAgents(ctx context.Context, check Check, ct *Container, deadline time.Time) CheckResult {
+	if !e.Agents.Enabled() {
+		return e.RunCheck(ctx, check, ct)
+	}
+
+	var votes map[string]CheckResult
+	var local CheckResult
+
+	if e.Agents.Local {
+		local = e.RunCheck(ctx, check, ct)
+	}
+
+	votes = e.Agents.collect(ctx, ct.Team.Name, check.Name, deadline)
+
+	if e.Agents.Local {
+		votes[AgentLocal] = local
+	}
+
+	return mergeAgentResults(e.Agents.Merge, votes)
+}
@@ -0,0 +1,119 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// MaxBoxReverts is the most reverts BoxRevertsJSON returns.
+const MaxBoxReverts = 100
+
+// snapshotContainer takes the snapshot reverts roll back to. Without it the
+// box still works, it just cannot be reverted.
+func (e *Environment) snapshotContainer(teamName, ipAddress string, ctID int, verbose bool) {
+	if err := e.proxmoxAPI.SnapshotContainer(nil, ctID, lib.Config.Revert.Snapshot); err != nil {
+		lib.Log.Warning(fmt.Sprintf("[%s][%s]: Failed to snapshot container, it cannot be reverted: %s", teamName, ipAddress, err.Error()))
+		return
+	}
+
+	if verbose {
+		lib.Log.Success(fmt.Sprintf("[%s][%s]: Snapshot %s taken", teamName, ipAddress, lib.Config.Revert.Snapshot))
+	}
+}
+
+// RequestRevert charges team for a revert and rolls its box back to the
+// snapshot taken after provisioning. The rollback runs in the background; the
+// charge is refunded if it fails.
+func (e *Environment) RequestRevert(team, actor string) (*database.DBBoxRevert, error) {
+	ct := e.TeamByName(team)
+
+	if ct == nil {
+		return nil, database.ErrTeamNotFound
+	}
+
+	revert, err := database.RequestBoxRevert(team, actor, lib.Config.Revert.Cost, lib.Config.Revert.Cooldown, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.refreshScores(); err != nil {
+		lib.Log.Error(fmt.Sprintf("[%s]: Failed to refresh scores: %s", team, err.Error()))
+	}
+
+	e.saveTeam(ct)
+	lib.Log.Status(fmt.Sprintf("[%s][%s]: %s requested a revert for %d points", team, ct.Team.ContainerIP, actor, revert.Cost))
+
+	go e.runRevert(ct, revert)
+
+	return revert, nil
+}
+
+func (e *Environment) runRevert(ct *Container, revert *database.DBBoxRevert) {
+	err := e.proxmoxAPI.RollbackContainer(nil, ct.Team.ContainerID, lib.Config.Revert.Snapshot)
+
+	if err == nil {
+		err = lib.WaitOnline(ct.Team.ContainerIP)
+	}
+
+	e.finishRevert(revert.ID, err)
+}
+
+func (e *Environment) finishRevert(id int64, failure error) {
+	revert, err := database.FinishBoxRevert(id, failure, time.Now())
+
+	if err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to record the end of revert %d: %s", id, err.Error()))
+		return
+	}
+
+	if failure == nil {
+		lib.Log.Success(fmt.Sprintf("[%s]: Box reverted", revert.Team))
+		return
+	}
+
+	lib.Log.Error(fmt.Sprintf("[%s]: Revert failed and was refunded: %s", revert.Team, failure.Error()))
+
+	if err := e.refreshScores(); err != nil {
+		lib.Log.Error(fmt.Sprintf("[%s]: Failed to refresh scores: %s", revert.Team, err.Error()))
+	}
+
+	if ct := e.TeamByName(revert.Team); ct != nil {
+		e.saveTeam(ct)
+	}
+}
+
+// FailInterruptedReverts refunds reverts that were still running when the
+// server last stopped, since nothing is watching them any more.
+func (e *Environment) FailInterruptedReverts() error {
+	ids, err := database.GetPendingBoxRevertIDs()
+
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		e.finishRevert(id, fmt.Errorf("interrupted by a restart"))
+	}
+
+	return nil
+}
+
+// BoxRevertsJSON lists the latest reverts, of team only unless it is empty.
+func BoxRevertsJSON(team string) ([]byte, error) {
+	reverts, err := database.GetBoxReverts(team, MaxBoxReverts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if reverts == nil {
+		reverts = []*database.DBBoxRevert{}
+	}
+
+	return json.Marshal(reverts)
+}
@@ -0,0 +1,184 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// CanaryTeam is the team name canaries run as.
+const CanaryTeam = "canary"
+
+// CanaryDefinition is a check run against Target, a host that should always be
+// up, such as the gateway or nameserver.
+type CanaryDefinition struct {
+	CheckDefinition
+	Target string `json:"target"`
+}
+
+type Canary struct {
+	Check
+	Target string `json:"target"`
+}
+
+var Canaries []Canary = []Canary{}
+
+// LoadCanaries compiles the canaries in path. Unlike the checks file there is
+// no fallback, a missing file runs no canaries.
+func LoadCanaries(path string) error {
+	raw, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		lib.Log.Warning(fmt.Sprintf("Canary file %s not found, rounds will not be checked for scorer outages", path))
+		Canaries = []Canary{}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read canary file: %w", err)
+	}
+
+	var defs []CanaryDefinition
+
+	if err := json.Unmarshal(raw, &defs); err != nil {
+		return fmt.Errorf("failed to parse canary file %s: %w", path, err)
+	}
+
+	var canaries []Canary = make([]Canary, 0, len(defs))
+
+	for _, def := range defs {
+		if def.Target == "" {
+			return fmt.Errorf("canary %s: target is required", def.Name)
+		}
+
+		if len(def.DependsOn) > 0 {
+			return fmt.Errorf("canary %s: canaries cannot depend on other checks", def.Name)
+		}
+
+		check, err := CompileCheck(def.CheckDefinition)
+
+		if err != nil {
+			return fmt.Errorf("canary %w", err)
+		}
+
+		canaries = append(canaries, Canary{Check: check, Target: def.Target})
+	}
+
+	if lib.Config.Canary.Required > len(canaries) {
+		return fmt.Errorf("CANARY_REQUIRED is %d but there are only %d canaries", lib.Config.Canary.Required, len(canaries))
+	}
+
+	Canaries = canaries
+	return nil
+}
+
+// runCanaries runs every canary at once and returns a description of each
+// one that failed, and whether enough of them passed for the round to count.
+func (e *Environment) runCanaries(ctx context.Context) ([]string, bool) {
+	if len(Canaries) == 0 {
+		return nil, true
+	}
+
+	var results []CheckResult = make([]CheckResult, len(Canaries))
+	var wg sync.WaitGroup
+
+	for i, canary := range Canaries {
+		wg.Add(1)
+		go func(i int, canary Canary) {
+			defer wg.Done()
+
+			results[i] = e.RunCheck(ctx, canary.Check, &Container{
+				Team: &database.DBTeam{
+					Name:        CanaryTeam,
+					ContainerIP: canary.Target,
+				},
+			})
+		}(i, canary)
+	}
+
+	wg.Wait()
+
+	var failed []string
+	var passed int
+
+	for i, result := range results {
+		if database.CheckStatusIsUp(result.Status) {
+			passed++
+			continue
+		}
+
+		failed = append(failed, fmt.Sprintf("%s (%s): %s", Canaries[i].Name, Canaries[i].Target, result.Reason))
+	}
+
+	return failed, passed >= lib.Config.Canary.Required
+}
+
+// VoidRound marks a round void, reverting every point it awarded, and raises
+// an alert.
+func (e *Environment) VoidRound(id int64, actor, reason string) ([]*database.DBLedgerEntry, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidAdjustment)
+	}
+
+	reverts, err := database.VoidRound(id, actor, reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.refreshScores(); err != nil {
+		return nil, err
+	}
+
+	if err := e.refreshOwnershipTotals(); err != nil {
+		return nil, err
+	}
+
+	for _, revert := range reverts {
+		if ct := e.TeamByName(revert.Team); ct != nil {
+			e.saveTeam(ct)
+		}
+	}
+
+	var message string = fmt.Sprintf("Round %d voided by %s: %s", id, actor, reason)
+
+	if err := database.CreateEvents([]*database.DBEvent{{
+		RoundID:   id,
+		CreatedAt: time.Now(),
+		Kind:      database.EventKindRoundVoid,
+		Subject:   actor,
+		Message:   message,
+	}}); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to record void of round %d: %s", id, err.Error()))
+	}
+
+	lib.Log.Error(message)
+
+	return reverts, nil
+}
+
+// voidIfScorerDown finishes and voids round when the canaries say the scorer
+// cannot reach known-good targets, so teams are not penalized for our own
+// outage.
+func (e *Environment) voidIfScorerDown(ctx context.Context, round *database.DBRound) bool {
+	failed, ok := e.runCanaries(ctx)
+
+	if ok {
+		return false
+	}
+
+	if err := database.FinishRound(round, time.Now()); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to finish round %d: %s", round.ID, err.Error()))
+	}
+
+	if _, err := e.VoidRound(round.ID, database.LedgerActorSystem, "canaries failed: "+strings.Join(failed, "; ")); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to void round %d: %s", round.ID, err.Error()))
+	}
+
+	return true
+}
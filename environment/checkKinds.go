@@ -0,0 +1,550 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+type checkCompiler func(params json.RawMessage) (CheckFunction, error)
+
+var checkKinds map[string]checkCompiler = map[string]checkCompiler{
+	"ping":         compilePingCheck,
+	"http":         compileHTTPCheck,
+	"tcp":          compileTCPCheck,
+	"ssh-command":  compileSSHCommandCheck,
+	"systemd-unit": compileSystemdUnitCheck,
+	"script":       compileScriptCheck,
+	"dns":          compileDNSCheck,
+	"smtp":         compileSMTPCheck,
+	"ftp":          compileFTPCheck,
+	"mysql":        compileMySQLCheck,
+	"postgres":     compilePostgresCheck,
+	"ldap":         compileLDAPCheck,
+}
+
+func decodeParams(raw json.RawMessage, into any) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(into); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+
+	return nil
+}
+
+func compilePingCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params struct{}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		if !lib.PingHostContext(ctx, c.Team.ContainerIP) {
+			return checkDown("", "no reply to ping from %s", c.Team.ContainerIP)
+		}
+
+		return checkUp("")
+	}, nil
+}
+
+type httpCheckParams struct {
+	Scheme    string `json:"scheme"`
+	Port      int    `json:"port"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+	MinLength int    `json:"minLength"`
+	JSON      string `json:"json"`
+	SHA256    string `json:"sha256"`
+	Match     string `json:"match"`
+	Contains  string `json:"contains"`
+	Body      string `json:"body"`
+}
+
+// contentTemplateData is available to the contains and body templates of
+// http checks, so the expected content can differ per team.
+type contentTemplateData struct {
+	Team string
+	IP   string
+}
+
+func compileContentTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	// Catch unknown fields now rather than failing every round
+	if err := tmpl.Execute(io.Discard, contentTemplateData{}); err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+func renderContentTemplate(tmpl *template.Template, c *Container) (string, error) {
+	var out strings.Builder
+
+	if err := tmpl.Execute(&out, contentTemplateData{
+		Team: c.Team.Name,
+		IP:   c.Team.ContainerIP,
+	}); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+func compileHTTPCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params httpCheckParams = httpCheckParams{
+		Scheme: "http",
+		Path:   "/",
+		Status: http.StatusOK,
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Scheme != "http" && params.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", params.Scheme)
+	}
+
+	if !strings.HasPrefix(params.Path, "/") {
+		params.Path = "/" + params.Path
+	}
+
+	switch params.JSON {
+	case "", "any", "array", "object":
+	default:
+		return nil, fmt.Errorf("unsupported json expectation %q", params.JSON)
+	}
+
+	params.SHA256 = strings.ToLower(params.SHA256)
+
+	if digest, err := hex.DecodeString(params.SHA256); params.SHA256 != "" && (err != nil || len(digest) != sha256.Size) {
+		return nil, fmt.Errorf("invalid sha256 %q", params.SHA256)
+	}
+
+	var match *regexp.Regexp
+
+	if params.Match != "" {
+		var err error
+
+		if match, err = regexp.Compile(params.Match); err != nil {
+			return nil, fmt.Errorf("invalid match: %w", err)
+		}
+	}
+
+	contains, err := compileContentTemplate("contains", params.Contains)
+
+	if err != nil {
+		return nil, err
+	}
+
+	expectedBody, err := compileContentTemplate("body", params.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		var host string = c.Team.ContainerIP
+
+		if params.Port != 0 {
+			host = net.JoinHostPort(host, fmt.Sprint(params.Port))
+		}
+
+		var url string = params.Scheme + "://" + host + params.Path
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+		if err != nil {
+			return checkDown("", "invalid request: %s", err)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			return checkDown("", "request failed: %s", err)
+		}
+
+		defer res.Body.Close()
+
+		rawBody, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		var body string = string(rawBody)
+
+		if res.StatusCode != params.Status {
+			return checkDown(body, "%s returned status %d, expected %d", url, res.StatusCode, params.Status)
+		}
+
+		if err != nil {
+			return checkDown(body, "failed to read body: %s", err)
+		}
+
+		if len(rawBody) < params.MinLength {
+			return checkDown(body, "body is %d bytes, expected at least %d", len(rawBody), params.MinLength)
+		}
+
+		var jsonData any
+
+		switch params.JSON {
+		case "array":
+			jsonData = &[]any{}
+		case "object":
+			jsonData = &map[string]any{}
+		case "any":
+			jsonData = new(any)
+		}
+
+		if jsonData != nil {
+			if err := json.Unmarshal(rawBody, jsonData); err != nil {
+				return checkDown(body, "body is not a JSON %s: %s", params.JSON, err)
+			}
+		}
+
+		if params.SHA256 != "" {
+			digest := sha256.Sum256(rawBody)
+
+			if hex.EncodeToString(digest[:]) != params.SHA256 {
+				return checkDown(body, "body does not match the expected sha256")
+			}
+		}
+
+		if match != nil && !match.Match(rawBody) {
+			return checkDown(body, "body does not match %q", params.Match)
+		}
+
+		if contains != nil {
+			expected, err := renderContentTemplate(contains, c)
+
+			if err != nil {
+				return checkDown(body, "failed to render contains: %s", err)
+			}
+
+			if !strings.Contains(body, expected) {
+				return checkDown(body, "body does not contain %q", expected)
+			}
+		}
+
+		if expectedBody != nil {
+			expected, err := renderContentTemplate(expectedBody, c)
+
+			if err != nil {
+				return checkDown(body, "failed to render body: %s", err)
+			}
+
+			if strings.TrimSpace(body) != strings.TrimSpace(expected) {
+				return checkDown(body, "body differs from the expected content")
+			}
+		}
+
+		return checkUp(body)
+	}, nil
+}
+
+type tcpCheckParams struct {
+	Port   int    `json:"port"`
+	Send   string `json:"send"`
+	Expect string `json:"expect"`
+}
+
+func compileTCPCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params tcpCheckParams
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Port <= 0 || params.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", params.Port)
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		var dialer net.Dialer
+
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.Team.ContainerIP, fmt.Sprint(params.Port)))
+
+		if err != nil {
+			return checkDown("", "connection failed: %s", err)
+		}
+
+		defer conn.Close()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		if params.Send != "" {
+			if _, err := conn.Write([]byte(params.Send)); err != nil {
+				return checkDown("", "failed to send: %s", err)
+			}
+		}
+
+		if params.Expect == "" {
+			return checkUp("")
+		}
+
+		buffer := make([]byte, 4096)
+		n, err := conn.Read(buffer)
+		var response string = string(buffer[:n])
+
+		if err != nil && n == 0 {
+			return checkDown("", "no response: %s", err)
+		}
+
+		if !strings.Contains(response, params.Expect) {
+			return checkDown(response, "response does not contain %q", params.Expect)
+		}
+
+		return checkUp(response)
+	}, nil
+}
+
+type sshCommandCheckParams struct {
+	Command  string `json:"command"`
+	ExitCode int    `json:"exitCode"`
+	Contains string `json:"contains"`
+
+	// Fresh dials a connection of its own instead of using the pool, for
+	// checks that verify root can still log in
+	Fresh bool `json:"fresh"`
+}
+
+func compileSSHCommandCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params sshCommandCheckParams
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		var run func(context.Context, string, string, int) (int, string, error) = lib.SSHClientPool.Run
+
+		if params.Fresh {
+			run = lib.SSHClientPool.RunFresh
+		}
+
+		statusCode, response, err := run(ctx, c.Team.ContainerIP, params.Command, 3)
+
+		if err != nil {
+			return checkDown(response, "ssh failed: %s", err)
+		}
+
+		if statusCode != params.ExitCode {
+			return checkDown(response, "%s exited with %d, expected %d", params.Command, statusCode, params.ExitCode)
+		}
+
+		if !strings.Contains(response, params.Contains) {
+			return checkDown(response, "output does not contain %q", params.Contains)
+		}
+
+		return checkUp(response)
+	}, nil
+}
+
+type systemdUnitCheckParams struct {
+	Units   []string `json:"units"`
+	Partial bool     `json:"partial"`
+}
+
+// compileSystemdUnitCheck requires every unit to be active, and partial,
+// true by default, gives the share of the reward for the units running.
+func compileSystemdUnitCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params systemdUnitCheckParams = systemdUnitCheckParams{
+		Partial: true,
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if len(params.Units) == 0 {
+		return nil, fmt.Errorf("at least one unit is required")
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		var evidence []string = make([]string, 0, len(params.Units))
+		var stopped []string
+
+		for _, unit := range params.Units {
+			statusCode, response, err := lib.SSHClientPool.Run(ctx, c.Team.ContainerIP, "systemctl status "+unit, 3)
+
+			if err != nil {
+				return checkDown(response, "ssh failed: %s", err)
+			}
+
+			if statusCode != 0 || !strings.Contains(response, "active (running)") {
+				if !params.Partial {
+					return checkDown(response, "unit %s is not active (running)", unit)
+				}
+
+				stopped = append(stopped, unit)
+				evidence = append(evidence, unit+": not running")
+				continue
+			}
+
+			evidence = append(evidence, unit+": active (running)")
+		}
+
+		switch len(stopped) {
+		case 0:
+			return checkUp(strings.Join(evidence, "\n"))
+		case len(params.Units):
+			return checkDown(strings.Join(evidence, "\n"), "no unit is active (running)")
+		}
+
+		var credit float64 = float64(len(params.Units)-len(stopped)) / float64(len(params.Units))
+		return checkPartial(credit, strings.Join(evidence, "\n"), "%s not active (running)", strings.Join(stopped, ", "))
+	}, nil
+}
+
+// Exit codes of script checks
+const (
+	ScriptExitUp      = 0
+	ScriptExitDown    = 1
+	ScriptExitPartial = 2
+)
+
+var scriptEnvName *regexp.Regexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type scriptCheckParams struct {
+	Path    string            `json:"path"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	Partial float64           `json:"partial"`
+}
+
+// compileScriptCheck runs a local executable against a container. It gets a
+// minimal environment: PATH, KOTH_TEAM, KOTH_IP, KOTH_TIMEOUT (seconds),
+// KOTH_SSH_KEY and KOTH_PARAM_<NAME> for every entry in env. Exit code 0 is
+// up, 1 is down and 2 earns the partial share of the reward; stdout is kept
+// as evidence and the last line of stderr as the reason.
+func compileScriptCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params scriptCheckParams = scriptCheckParams{
+		Partial: 0.5,
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	if info, err := os.Stat(params.Path); err != nil {
+		return nil, fmt.Errorf("script %s: %w", params.Path, err)
+	} else if info.IsDir() || info.Mode()&0111 == 0 {
+		return nil, fmt.Errorf("script %s is not executable", params.Path)
+	}
+
+	if params.Partial < 0 || params.Partial > 1 {
+		return nil, fmt.Errorf("partial must be between 0 and 1")
+	}
+
+	var env []string = []string{"PATH=" + os.Getenv("PATH")}
+	var names map[string]string = make(map[string]string, len(params.Env))
+
+	for _, name := range slices.Sorted(maps.Keys(params.Env)) {
+		if !scriptEnvName.MatchString(name) {
+			return nil, fmt.Errorf("invalid env name %q", name)
+		}
+
+		// Names are uppercased, so e.g. port and PORT would be one variable
+		var variable string = "KOTH_PARAM_" + strings.ToUpper(name)
+
+		if other, ok := names[variable]; ok {
+			return nil, fmt.Errorf("env names %q and %q are both %s", other, name, variable)
+		}
+
+		names[variable] = name
+		env = append(env, variable+"="+params.Env[name])
+	}
+
+	// Every run appends to env, so it must never share a backing array
+	env = slices.Clip(env)
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		var stdout, stderr bytes.Buffer
+
+		cmd := exec.CommandContext(ctx, params.Path, params.Args...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		cmd.WaitDelay = time.Second
+		cmd.Env = append(env,
+			"KOTH_TEAM="+c.Team.Name,
+			"KOTH_IP="+c.Team.ContainerIP,
+			"KOTH_SSH_KEY="+lib.Config.SSH.PrivateKeyPath,
+		)
+
+		if deadline, ok := ctx.Deadline(); ok {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("KOTH_TIMEOUT=%d", int(math.Ceil(time.Until(deadline).Seconds()))))
+		}
+
+		err := cmd.Run()
+
+		var reason string = strings.TrimSpace(stderr.String())
+
+		if i := strings.LastIndexByte(reason, '\n'); i >= 0 {
+			reason = reason[i+1:]
+		}
+
+		var exitErr *exec.ExitError
+		var exitCode int
+
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			return checkDown(stdout.String(), "failed to run %s: %s", params.Path, err)
+		}
+
+		switch exitCode {
+		case ScriptExitUp:
+			return checkUp(stdout.String())
+		case ScriptExitPartial:
+			if reason == "" {
+				reason = "partially up"
+			}
+
+			return checkPartial(params.Partial, stdout.String(), "%s", reason)
+		case ScriptExitDown:
+			if reason == "" {
+				reason = "down"
+			}
+
+			return checkDown(stdout.String(), "%s", reason)
+		}
+
+		return checkDown(stdout.String(), "exited with %d: %s", exitCode, reason)
+	}, nil
+}
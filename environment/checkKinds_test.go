@@ -0,0 +1,39 @@
+package environment
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileScriptCheckRejectsCollidingEnvNames(t *testing.T) {
+	var path string = filepath.Join(t.TempDir(), "check.sh")
+
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(map[string]any{
+		"path": path,
+		"env":  map[string]string{"port": "21", "PORT": "2121"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := compileScriptCheck(raw); err == nil || !strings.Contains(err.Error(), "KOTH_PARAM_PORT") {
+		t.Fatalf("expected port and PORT to be rejected, got %v", err)
+	}
+
+	raw, _ = json.Marshal(map[string]any{
+		"path": path,
+		"env":  map[string]string{"port": "21", "user": "ftp"},
+	})
+
+	if _, err := compileScriptCheck(raw); err != nil {
+		t.Fatalf("distinct names were rejected: %s", err)
+	}
+}
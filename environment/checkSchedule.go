@@ -0,0 +1,112 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// checkDue reports whether check runs for this container in the current
+// round, and counts down to its next run. Each container starts at a random
+// point of the check's interval, so checks that do not run every round are
+// spread evenly across the rounds of their interval.
+func (ct *Container) checkDue(check Check) bool {
+	if ct.checkCountdown == nil {
+		ct.checkCountdown = make(map[string]int)
+	}
+
+	left, ok := ct.checkCountdown[check.Name]
+
+	if !ok {
+		left = rand.IntN(check.Every)
+	}
+
+	if left > 0 {
+		ct.checkCountdown[check.Name] = left - 1
+		return false
+	}
+
+	ct.checkCountdown[check.Name] = check.Every - 1
+	return true
+}
+
+// checkOffsets decides when, relative to the start of the round, each check
+// starts for each of n containers. A check's jitter window is cut into n
+// equal slots and every container gets a random time in a different slot,
+// so the load is even across the window but the order changes every round.
+func checkOffsets(checks []Check, n int) [][]time.Duration {
+	var offsets [][]time.Duration = make([][]time.Duration, len(checks))
+
+	for i, check := range checks {
+		offsets[i] = make([]time.Duration, n)
+
+		if check.Jitter <= 0 || n == 0 {
+			continue
+		}
+
+		var slot float64 = float64(check.Jitter) / float64(n)
+
+		for container, position := range rand.Perm(n) {
+			offsets[i][container] = time.Duration((float64(position) + rand.Float64()) * slot)
+		}
+	}
+
+	return offsets
+}
+
+// waitUntil sleeps until t, returning early if ctx is done.
+func waitUntil(ctx context.Context, t time.Time) {
+	var wait time.Duration = time.Until(t)
+
+	if wait <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// CheckRoundBudget makes sure every check finishes within a round in the
+// worst case. The canaries run first, then a check starts at the end of its
+// jitter window or once the checks it depends on end, whichever is later,
+// and takes its full timeout plus the agents' grace.
+func (e *Environment) CheckRoundBudget() error {
+	var canaryTimeout time.Duration
+
+	for _, canary := range Canaries {
+		canaryTimeout = max(canaryTimeout, canary.Timeout)
+	}
+
+	var grace time.Duration
+
+	if e.Agents.Enabled() {
+		grace = e.Agents.Grace
+	}
+
+	var budget time.Duration = lib.Config.Scoring.RoundInterval - canaryTimeout
+	var ends map[string]time.Duration = make(map[string]time.Duration, len(ScoringChecks))
+
+	for _, check := range ScoringChecks {
+		var start time.Duration = check.Jitter
+
+		for _, dependency := range check.DependsOn {
+			start = max(start, ends[dependency])
+		}
+
+		ends[check.Name] = start + check.Timeout + grace
+
+		if ends[check.Name] > budget {
+			return fmt.Errorf("check %s can take until %s into a round, but only %s of the %s round is left after the canaries", check.Name, ends[check.Name], budget, lib.Config.Scoring.RoundInterval)
+		}
+	}
+
+	return nil
+}
@@ -1,9 +1,12 @@
 package environment
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -46,6 +49,17 @@ type Container struct {
 	ServiceChecksCount, ServiceChecksPassed int
 	UpdatedAt                               time.Time
 	PassedChecks, FailedChecks              []string
+	TimedOutChecks, PartialChecks           []string
+	SkippedChecks                           []string
+	Ownership                               ContainerOwnership
+	SLA                                     map[string]*ServiceSLA
+
+	// Only touched by runScoring, outside of rounds or from the container's
+	// own goroutine
+	checkCountdown map[string]int
+	checkStatuses  map[string]string
+
+	slaMutex sync.Mutex
 }
 
 type SavedState struct {
@@ -58,12 +72,23 @@ type Environment struct {
 
 	nodeCreationTracker int
 	SavedState          *SavedState
+	Schedule            *Schedule
+	Freeze              *Freeze
+	Multipliers         *Multipliers
+	Agents              *Agents
+	RedTeam             *RedTeam
+
+	scoreMutex sync.Mutex
 }
 
 func NewEnvironment(proxmoxAPI *lib.ProxmoxAPI) *Environment {
 	return &Environment{
-		Containers: []*Container{},
-		proxmoxAPI: proxmoxAPI,
+		Containers:  []*Container{},
+		proxmoxAPI:  proxmoxAPI,
+		Schedule:    &Schedule{},
+		Freeze:      &Freeze{},
+		Multipliers: &Multipliers{},
+		Agents:      &Agents{},
 	}
 }
 
@@ -96,6 +121,26 @@ func (e *Environment) PullFromDatabase() error {
 		lib.Log.Warning("No containers found in database")
 	}
 
+	if err := e.pullOwnershipFromDatabase(); err != nil {
+		return fmt.Errorf("failed to get ownership from database: %w", err)
+	}
+
+	if err := e.pullSLAFromDatabase(); err != nil {
+		return fmt.Errorf("failed to get SLA state from database: %w", err)
+	}
+
+	if err := e.refreshScores(); err != nil {
+		return fmt.Errorf("failed to get scores from ledger: %w", err)
+	}
+
+	if err := e.pullFreezeFromDatabase(); err != nil {
+		return fmt.Errorf("failed to get scoreboard freeze from database: %w", err)
+	}
+
+	if err := e.pullMultipliersFromDatabase(); err != nil {
+		return fmt.Errorf("failed to get multipliers from database: %w", err)
+	}
+
 	return nil
 }
 
@@ -178,10 +223,24 @@ func (e *Environment) createContainerStep3(teamName, ipAddress string, ctID int,
 		lib.Log.Success(fmt.Sprintf("[%s][%s]: Container initialized in %s", teamName, ipAddress, time.Since(startTime)))
 	}
 
+	if e.RedTeam.Enabled() {
+		if err := e.plantFlags(conn, teamName); err != nil {
+			return err
+		}
+
+		if verbose {
+			lib.Log.Success(fmt.Sprintf("[%s][%s]: Planted %d red team flags", teamName, ipAddress, len(e.RedTeam.Flags)))
+		}
+	}
+
+	e.snapshotContainer(teamName, ipAddress, ctID, verbose)
+
 	return nil
 }
 
-func (e *Environment) createContainerStep4(teamName, ipAddress string, ctID int, verbose bool) error {
+// createContainerStep4 adds the team and returns its portal password. Only
+// the hash is stored, so the caller must hand the password to the admin.
+func (e *Environment) createContainerStep4(teamName, ipAddress string, ctID int, verbose bool) (string, error) {
 	if verbose {
 		lib.Log.Status(fmt.Sprintf("[%s][%s]: Creating team in database", teamName, ipAddress))
 	}
@@ -189,13 +248,19 @@ func (e *Environment) createContainerStep4(teamName, ipAddress string, ctID int,
 	team, err := database.CreateTeam(teamName, ipAddress, ctID, 0)
 
 	if err != nil {
-		return fmt.Errorf("failed to create team in database: %w", err)
+		return "", fmt.Errorf("failed to create team in database: %w", err)
 	}
 
 	if verbose {
 		lib.Log.Success(fmt.Sprintf("[%s][%s]: Team created in database", teamName, ipAddress))
 	}
 
+	password, err := CreateTeamAccount(teamName)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to create team account: %w", err)
+	}
+
 	if verbose {
 		lib.Log.Status(fmt.Sprintf("[%s][%s]: Adding container to environment", teamName, ipAddress))
 	}
@@ -203,7 +268,7 @@ func (e *Environment) createContainerStep4(teamName, ipAddress string, ctID int,
 	container, err := e.proxmoxAPI.GetContainer(nil, ctID)
 
 	if err != nil {
-		return fmt.Errorf("failed to get container: %w", err)
+		return "", fmt.Errorf("failed to get container: %w", err)
 	}
 
 	e.Containers = append(e.Containers, &Container{
@@ -215,29 +280,33 @@ func (e *Environment) createContainerStep4(teamName, ipAddress string, ctID int,
 		lib.Log.Success(fmt.Sprintf("[%s][%s]: Container added to environment", teamName, ipAddress))
 	}
 
-	return nil
+	return password, nil
 }
 
-func (e *Environment) CreateContainer(teamName, ipAddress string, verbose bool) (*Container, error) {
+// CreateContainer provisions a team's box and returns the container with the
+// team's portal password, which is not kept anywhere else.
+func (e *Environment) CreateContainer(teamName, ipAddress string, verbose bool) (*Container, string, error) {
 	ctID, err := e.createContainerStep1(teamName, ipAddress, verbose)
 
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if err := e.createContainerStep2(teamName, ipAddress, ctID, verbose); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if err := e.createContainerStep3(teamName, ipAddress, ctID, verbose); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	if err := e.createContainerStep4(teamName, ipAddress, ctID, verbose); err != nil {
-		return nil, err
+	password, err := e.createContainerStep4(teamName, ipAddress, ctID, verbose)
+
+	if err != nil {
+		return nil, "", err
 	}
 
-	return e.Containers[len(e.Containers)-1], nil
+	return e.Containers[len(e.Containers)-1], password, nil
 }
 
 func (e *Environment) Print() {
@@ -250,12 +319,32 @@ func (e *Environment) JSON() ([]byte, error) {
 	containers := make([]map[string]any, len(e.Containers))
 
 	for i, container := range e.Containers {
+		var services map[string]any = make(map[string]any)
+
+		for check, sla := range container.SLASnapshot() {
+			services[check] = map[string]any{
+				"uptime":     sla.Uptime(),
+				"streak":     sla.Streak,
+				"violations": sla.Violations,
+			}
+		}
+
 		containers[i] = map[string]any{
 			"container": map[string]any{
 				"pve_id": container.Team.ContainerID,
 				"ipv4":   container.Team.ContainerIP,
 				"status": container.Container.Status,
 			},
+			"king": func() any {
+				if container.Ownership.King == "" {
+					return nil
+				}
+
+				return map[string]any{
+					"team": container.Ownership.King,
+					"role": container.Ownership.KingRole,
+				}
+			}(),
 			"team": map[string]any{
 				"name":  container.Team.Name,
 				"score": container.Team.Score,
@@ -266,15 +355,24 @@ func (e *Environment) JSON() ([]byte, error) {
 
 					return math.Round(float64(container.Team.UptimeChecksPassed)/float64(container.Team.UptimeChecksTotal)*100) / 100
 				}(),
+				"ownership": map[string]any{
+					"defended": container.Ownership.Defended,
+					"captured": container.Ownership.Captured,
+					"points":   container.Ownership.Points,
+				},
 				"checks": map[string]any{
 					"total":  container.Team.ServiceChecksTotal,
 					"passed": container.Team.ServiceChecksPassed,
 					"failed": container.Team.ServiceChecksTotal - container.Team.ServiceChecksPassed,
 					"named": map[string]any{
-						"passed": container.PassedChecks,
-						"failed": container.FailedChecks,
+						"passed":  container.PassedChecks,
+						"failed":  container.FailedChecks,
+						"timeout": container.TimedOutChecks,
+						"partial": container.PartialChecks,
+						"skipped": container.SkippedChecks,
 					},
 				},
+				"services": services,
 			},
 			"lastUpdate": container.UpdatedAt.Format(time.RFC3339),
 		}
@@ -289,11 +387,64 @@ func (e *Environment) JSON() ([]byte, error) {
 	return jsonData, nil
 }
 
+// runScoring runs a single round. Every round is cancelled once the round
+// interval has elapsed, so rounds never overlap.
 func (e *Environment) runScoring() {
+	ctx, cancel := context.WithTimeout(context.Background(), lib.Config.Scoring.RoundInterval)
+	defer cancel()
+
+	var started time.Time = time.Now()
+	round, err := database.CreateRound(started)
+
+	if err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to create scoring round: %s", err.Error()))
+		return
+	}
+
+	if e.voidIfScorerDown(ctx, round) {
+		return
+	}
+
+	var roundResults [][]*database.DBCheckResult = make([][]*database.DBCheckResult, len(e.Containers))
+	var claims []string = make([]string, len(e.Containers))
+	var roundEvents [][]*database.DBEvent = make([][]*database.DBEvent, len(e.Containers))
+	var offsets [][]time.Duration = checkOffsets(ScoringChecks, len(e.Containers))
+	var due [][]bool = make([][]bool, len(e.Containers))
+	var checkIndex map[string]int = make(map[string]int, len(ScoringChecks))
+	var assignments []AgentAssignment
+
+	for j, check := range ScoringChecks {
+		checkIndex[check.Name] = j
+	}
+
+	for i, ct := range e.Containers {
+		due[i] = make([]bool, len(ScoringChecks))
+
+		for j, check := range ScoringChecks {
+			if due[i][j] = ct.checkDue(check); due[i][j] {
+				assignments = append(assignments, AgentAssignment{
+					Team:     ct.Team.Name,
+					IP:       ct.Team.ContainerIP,
+					Check:    check.Name,
+					OffsetMS: offsets[j][i].Milliseconds(),
+				})
+			}
+		}
+	}
+
+	if e.Agents.Enabled() {
+		e.Agents.startRound(AgentRound{
+			Round:       round.ID,
+			StartedAt:   started,
+			Deadline:    started.Add(lib.Config.Scoring.RoundInterval),
+			Assignments: assignments,
+		})
+	}
+
 	wg := &sync.WaitGroup{}
-	for _, container := range e.Containers {
+	for i, container := range e.Containers {
 		wg.Add(1)
-		go func(ct *Container) {
+		go func(i int, ct *Container) {
 			defer wg.Done()
 
 			serviceChecksPassed := 0
@@ -304,31 +455,175 @@ func (e *Environment) runScoring() {
 
 			passedChecks := []string{}
 			failedChecks := []string{}
+			timedOutChecks := []string{}
+			partialChecks := []string{}
+			skippedChecks := []string{}
+
+			// A dependency that did not run this round counts with its last
+			// status
+			if ct.checkStatuses == nil {
+				ct.checkStatuses = make(map[string]string, len(ScoringChecks))
+			}
+
+			// Every check starts at its own offset, so a slow check cannot
+			// push the ones after it past the end of the round. A check
+			// only waits for the checks it depends on.
+			var checkResults []CheckResult = make([]CheckResult, len(ScoringChecks))
+			var roundEnded []bool = make([]bool, len(ScoringChecks))
+			var finished []chan struct{} = make([]chan struct{}, len(ScoringChecks))
+			var statusLock sync.Mutex
+			checksWG := &sync.WaitGroup{}
+
+			for j, check := range ScoringChecks {
+				if !due[i][j] {
+					continue
+				}
+
+				finished[j] = make(chan struct{})
+				checksWG.Add(1)
+
+				go func(j int, check Check) {
+					defer checksWG.Done()
+					defer close(finished[j])
+
+					for _, dependency := range check.DependsOn {
+						if done := finished[checkIndex[dependency]]; done != nil {
+							<-done
+						}
+					}
+
+					statusLock.Lock()
+					dependency := check.unmetDependency(ct.checkStatuses)
+					status := ct.checkStatuses[dependency]
+					statusLock.Unlock()
+
+					if dependency != "" {
+						if status == "" {
+							status = "not checked yet"
+						}
+
+						checkResults[j] = CheckResult{
+							Status: database.CheckStatusSkipped,
+							Reason: fmt.Sprintf("skipped, depends on %s which is %s", dependency, status),
+						}
+					} else {
+						waitUntil(ctx, started.Add(offsets[j][i]))
+						checkResults[j] = e.runCheckWithAgents(ctx, check, ct, started.Add(offsets[j][i]+check.Timeout+e.Agents.Grace))
+
+						// A check the round cut short says nothing about the
+						// service
+						if ctx.Err() != nil && !database.CheckStatusIsUp(checkResults[j].Status) {
+							checkResults[j] = CheckResult{
+								Status:  database.CheckStatusSkipped,
+								Latency: checkResults[j].Latency,
+								Reason:  "round ended before the check finished",
+							}
+							roundEnded[j] = true
+						}
+					}
+
+					statusLock.Lock()
+					ct.checkStatuses[check.Name] = checkResults[j].Status
+					statusLock.Unlock()
+				}(j, check)
+			}
 
-			scoreToAdd := 0
+			checksWG.Wait()
+
+			results := make([]*database.DBCheckResult, 0, len(ScoringChecks))
+
+			for j, check := range ScoringChecks {
+				if !due[i][j] {
+					continue
+				}
 
-			for _, check := range ScoringChecks {
 				serviceChecksTotal++
 
-				if check.CheckFunction(e, ct) {
+				result := &database.DBCheckResult{
+					RoundID: round.ID,
+					Team:    ct.Team.Name,
+					Check:   check.Name,
+				}
+
+				var checkResult CheckResult = checkResults[j]
+				multiplier := e.Multipliers.Active(round.StartedAt, e.Schedule.End, check.Name)
+
+				result.Status = checkResult.Status
+				result.LatencyMS = checkResult.Latency.Milliseconds()
+				result.Reason = checkResult.Reason
+				result.Evidence = checkResult.Evidence
+				result.Multipliers = strings.Join(multiplier.Rules, ",")
+
+				switch result.Status {
+				case database.CheckStatusUp:
 					serviceChecksPassed++
-					scoreToAdd += check.Reward
+					result.Multiplier = multiplier.Reward
+					result.Points = check.Points(result.Status, result.Multiplier, 0)
 
-					if check.Name == "Ping" {
+					if check.Uptime {
 						uptimePassed++
 						uptimeTotal++
 					}
 
 					passedChecks = append(passedChecks, check.Name)
-				} else {
-					scoreToAdd -= check.Penalty
+				case database.CheckStatusPartial:
+					result.Multiplier = multiplier.Reward
+					result.Credit = &checkResult.Credit
+					result.Points = check.Points(result.Status, result.Multiplier, checkResult.Credit)
+
+					if check.Uptime {
+						uptimePassed++
+						uptimeTotal++
+					}
+
+					partialChecks = append(partialChecks, check.Name)
+				case database.CheckStatusSkipped:
+					result.Multiplier = multiplier.Penalty
+
+					// Stored as a zero multiplier so rescoring keeps it free
+					if roundEnded[j] {
+						result.Multiplier = 0
+					}
+
+					result.Points = check.Points(result.Status, result.Multiplier, 0)
+
+					skippedChecks = append(skippedChecks, check.Name)
+				default:
+					result.Multiplier = multiplier.Penalty
+					result.Points = check.Points(result.Status, result.Multiplier, 0)
 
-					if check.Name == "Ping" {
+					if check.Uptime {
 						uptimeTotal++
 					}
 
 					failedChecks = append(failedChecks, check.Name)
+
+					if result.Status == database.CheckStatusTimeout {
+						timedOutChecks = append(timedOutChecks, check.Name)
+					}
+				}
+
+				results = append(results, result)
+
+				if result.Status == database.CheckStatusSkipped {
+					continue
+				}
+
+				if event := ct.recordSLA(round, check, result.Status); event != nil {
+					roundEvents[i] = append(roundEvents[i], event)
+				}
+			}
+
+			roundResults[i] = results
+
+			if lib.Config.Ownership.Enabled {
+				claim, err := readClaim(ctx, ct)
+
+				if err != nil {
+					lib.Log.Warning(fmt.Sprintf("[%s][%s]: Failed to read ownership claim: %s", ct.Team.Name, ct.Team.ContainerIP, err.Error()))
 				}
+
+				claims[i] = claim
 			}
 
 			ct.UpdatedAt = time.Now()
@@ -336,34 +631,134 @@ func (e *Environment) runScoring() {
 			ct.ServiceChecksPassed = serviceChecksPassed
 			ct.PassedChecks = passedChecks
 			ct.FailedChecks = failedChecks
+			ct.TimedOutChecks = timedOutChecks
+			ct.PartialChecks = partialChecks
+			ct.SkippedChecks = skippedChecks
 
 			ct.Team.ServiceChecksTotal = serviceChecksTotal
 			ct.Team.ServiceChecksPassed = serviceChecksPassed
 			ct.Team.UptimeChecksTotal += uptimeTotal
 			ct.Team.UptimeChecksPassed += uptimePassed
-			ct.Team.Score += scoreToAdd
-		}(container)
+		}(i, container)
 	}
 
 	wg.Wait()
 
-	for _, container := range e.Containers {
-		if err := database.UpdateTeam(container.Team); err != nil {
-			lib.Log.Error(fmt.Sprintf("[%s][%s]: Failed to update team in database: %s", container.Team.Name, container.Team.ContainerIP, err.Error()))
+	if e.Agents.Enabled() {
+		e.Agents.endRound()
+	}
+
+	var ledger []*database.DBLedgerEntry
+
+	for i, container := range e.Containers {
+		var points int
+		var multipliers []string
+
+		for _, result := range roundResults[i] {
+			points += result.Points
+
+			for _, name := range strings.Split(result.Multipliers, ",") {
+				if name != "" && !slices.Contains(multipliers, name) {
+					multipliers = append(multipliers, name)
+				}
+			}
+		}
+
+		if points != 0 {
+			var reason string = fmt.Sprintf("Round %d checks", round.ID)
+
+			if len(multipliers) > 0 {
+				reason += " with multipliers " + strings.Join(multipliers, ", ")
+			}
+
+			ledger = append(ledger, &database.DBLedgerEntry{
+				Team:    container.Team.Name,
+				Source:  database.LedgerSourceCheck,
+				Amount:  points,
+				Reason:  reason,
+				Actor:   database.LedgerActorSystem,
+				RoundID: round.ID,
+			})
 		}
+
+		for _, event := range roundEvents[i] {
+			ledger = append(ledger, &database.DBLedgerEntry{
+				Team:    container.Team.Name,
+				Source:  database.LedgerSourceSLA,
+				Amount:  event.Points,
+				Reason:  event.Message,
+				Actor:   database.LedgerActorSystem,
+				RoundID: round.ID,
+			})
+		}
+	}
+
+	if lib.Config.Ownership.Enabled {
+		ledger = append(ledger, e.awardOwnership(round, claims)...)
+	}
+
+	if err := e.applyLedger(ledger); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to record scores for round %d: %s", round.ID, err.Error()))
+	}
+
+	for _, container := range e.Containers {
+		e.saveTeam(container)
+	}
+
+	var allResults []*database.DBCheckResult
+	for _, results := range roundResults {
+		allResults = append(allResults, results...)
+	}
+
+	if err := database.CreateCheckResults(allResults); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to record results for round %d: %s", round.ID, err.Error()))
+	}
+
+	var allEvents []*database.DBEvent
+	for _, events := range roundEvents {
+		allEvents = append(allEvents, events...)
+	}
+
+	if err := database.CreateEvents(allEvents); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to record events for round %d: %s", round.ID, err.Error()))
+	}
+
+	if err := database.FinishRound(round, time.Now()); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to finish round %d: %s", round.ID, err.Error()))
 	}
 }
 
+// InitAutoUpdate starts a round every round interval while the schedule is
+// running. The schedule is polled every second so that rounds start promptly
+// when the event starts, a break ends or an admin resumes.
 func (e *Environment) InitAutoUpdate() chan bool {
 	stop := make(chan bool)
 
 	go func() {
-		e.runScoring()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		var lastRound time.Time
+		var lastPhase string
 
 		for {
-			select {
-			case <-time.After(30 * time.Second):
+			now := time.Now()
+
+			e.autoFreeze(now)
+			e.releaseInjects(now)
+
+			if phase := e.Schedule.Phase(now); phase != lastPhase {
+				lib.Log.Status(fmt.Sprintf("Event phase is now %s", phase))
+				lastPhase = phase
+			}
+
+			if lastPhase == PhaseRunning && now.Sub(lastRound) >= lib.Config.Scoring.RoundInterval {
+				lastRound = now
 				e.runScoring()
+			}
+
+			select {
+			case <-ticker.C:
 			case <-stop:
 				return
 			}
@@ -373,8 +768,12 @@ func (e *Environment) InitAutoUpdate() chan bool {
 	return stop
 }
 
-func (e *Environment) BulkCreate(inputs [][]string, bucketSize int) {
+// BulkCreate creates the teams in inputs and returns their portal
+// passwords by team name.
+func (e *Environment) BulkCreate(inputs [][]string, bucketSize int) map[string]string {
 	var buckets [][][]string = make([][][]string, 1)
+	var passwords map[string]string = make(map[string]string, len(inputs))
+	var passwordsLock sync.Mutex
 
 	for i, input := range inputs {
 		if i%bucketSize == 0 {
@@ -393,9 +792,16 @@ func (e *Environment) BulkCreate(inputs [][]string, bucketSize int) {
 			go func(i []string) {
 				defer wg.Done()
 
-				if _, err := e.CreateContainer(i[0], i[1], true); err != nil {
+				_, password, err := e.CreateContainer(i[0], i[1], true)
+
+				if err != nil {
 					lib.Log.Error(fmt.Sprintf("[%s][%s]: Failed to create container: %s", i[0], i[1], err.Error()))
+					return
 				}
+
+				passwordsLock.Lock()
+				passwords[i[0]] = password
+				passwordsLock.Unlock()
 			}(input)
 
 			time.Sleep(10 * time.Second)
@@ -403,6 +809,8 @@ func (e *Environment) BulkCreate(inputs [][]string, bucketSize int) {
 
 		wg.Wait()
 	}
+
+	return passwords
 }
 
 type intermediateContainer struct {
@@ -410,8 +818,11 @@ type intermediateContainer struct {
 	teamName, ipAddress string
 }
 
-func (e *Environment) EfficientBulkCreate(inputs [][]string, bucketSize int) {
+// EfficientBulkCreate is BulkCreate with each step run for a whole bucket of
+// teams at once.
+func (e *Environment) EfficientBulkCreate(inputs [][]string, bucketSize int) map[string]string {
 	var buckets [][][]string = make([][][]string, 1)
+	var passwords map[string]string = make(map[string]string, len(inputs))
 
 	for i, input := range inputs {
 		if i%bucketSize == 0 {
@@ -470,11 +881,18 @@ func (e *Environment) EfficientBulkCreate(inputs [][]string, bucketSize int) {
 		wg.Wait()
 
 		for _, ctID := range ctIDs {
-			if err := e.createContainerStep4(ctID.teamName, ctID.ipAddress, ctID.ctID, true); err != nil {
+			password, err := e.createContainerStep4(ctID.teamName, ctID.ipAddress, ctID.ctID, true)
+
+			if err != nil {
 				lib.Log.Error(fmt.Sprintf("[%s][%s]: Failed to create container: %s", ctID.teamName, ctID.ipAddress, err.Error()))
+				continue
 			}
+
+			passwords[ctID.teamName] = password
 		}
 	}
+
+	return passwords
 }
 
 func (e *Environment) TeamByName(name string) *Container {
@@ -0,0 +1,243 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// freezeBlob holds the freeze state, so a frozen board survives a restart.
+const freezeBlob = "scoreboard.freeze"
+
+// freezeState is what the public saw when the scoreboard was frozen. Scoring
+// carries on underneath; only the public endpoints serve the snapshot.
+type freezeState struct {
+	FrozenAt    time.Time       `json:"frozenAt"`
+	RevealedAt  time.Time       `json:"revealedAt"`
+	LastEventID int64           `json:"lastEventId"`
+	Summary     json.RawMessage `json:"summary"`
+	Matrix      json.RawMessage `json:"matrix"`
+}
+
+func (s freezeState) frozen() bool {
+	return !s.FrozenAt.IsZero() && s.RevealedAt.IsZero()
+}
+
+// frozenTeam is a team as the frozen summary shows it.
+type frozenTeam struct {
+	Name     string          `json:"name"`
+	Score    int             `json:"score"`
+	Uptime   float64         `json:"uptime"`
+	Services json.RawMessage `json:"services"`
+}
+
+// team returns name's entry of the frozen summary. A team created after the
+// freeze is not on it.
+func (s freezeState) team(name string) (frozenTeam, bool) {
+	var containers []struct {
+		Team frozenTeam `json:"team"`
+	}
+
+	if err := json.Unmarshal(s.Summary, &containers); err != nil {
+		return frozenTeam{}, false
+	}
+
+	for _, container := range containers {
+		if container.Team.Name == name {
+			return container.Team, true
+		}
+	}
+
+	return frozenTeam{}, false
+}
+
+type Freeze struct {
+	mutex sync.Mutex
+	state freezeState
+}
+
+func (f *Freeze) snapshot() freezeState {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.state
+}
+
+func (f *Freeze) save(state freezeState) error {
+	raw, err := json.Marshal(state)
+
+	if err != nil {
+		return err
+	}
+
+	if err := database.SetBlob(freezeBlob, string(raw)); err != nil {
+		return err
+	}
+
+	f.state = state
+	return nil
+}
+
+func (e *Environment) pullFreezeFromDatabase() error {
+	if !database.BlobExists(freezeBlob) {
+		return nil
+	}
+
+	blob, err := database.GetBlob(freezeBlob)
+
+	if err != nil {
+		return err
+	}
+
+	e.Freeze.mutex.Lock()
+	defer e.Freeze.mutex.Unlock()
+
+	return json.Unmarshal([]byte(blob.Value), &e.Freeze.state)
+}
+
+// Frozen reports whether the public scoreboard is frozen, and since when.
+func (e *Environment) Frozen() (bool, time.Time) {
+	state := e.Freeze.snapshot()
+	return state.frozen(), state.FrozenAt
+}
+
+// FreezeScoreboard snapshots the public standings. Until the scoreboard is
+// revealed, public endpoints serve the snapshot and admins keep live data.
+func (e *Environment) FreezeScoreboard() error {
+	e.Freeze.mutex.Lock()
+	defer e.Freeze.mutex.Unlock()
+
+	if e.Freeze.state.frozen() {
+		return nil
+	}
+
+	summary, err := e.JSON()
+
+	if err != nil {
+		return err
+	}
+
+	matrix, err := e.MatrixJSON(DefaultMatrixRounds)
+
+	if err != nil {
+		return err
+	}
+
+	var lastEventID int64
+
+	if events, err := database.GetEvents(0, 0, "", "", 1); err != nil {
+		return err
+	} else if len(events) > 0 {
+		lastEventID = events[0].ID
+	}
+
+	if err := e.Freeze.save(freezeState{
+		FrozenAt:    time.Now(),
+		LastEventID: lastEventID,
+		Summary:     summary,
+		Matrix:      matrix,
+	}); err != nil {
+		return err
+	}
+
+	lib.Log.Important("Scoreboard frozen")
+	return nil
+}
+
+// RevealScoreboard unfreezes the scoreboard, publishing the live standings.
+func (e *Environment) RevealScoreboard() error {
+	e.Freeze.mutex.Lock()
+	defer e.Freeze.mutex.Unlock()
+
+	if !e.Freeze.state.frozen() {
+		return nil
+	}
+
+	var state freezeState = e.Freeze.state
+	state.RevealedAt = time.Now()
+
+	if err := e.Freeze.save(state); err != nil {
+		return err
+	}
+
+	lib.Log.Important("Scoreboard revealed")
+	return nil
+}
+
+// autoFreeze freezes the scoreboard once the event is within
+// EVENT_FREEZE_BEFORE of its end. It only ever fires once, so a reveal
+// before the end is not undone.
+func (e *Environment) autoFreeze(now time.Time) {
+	if lib.Config.Event.FreezeBefore <= 0 || e.Schedule.End.IsZero() {
+		return
+	}
+
+	if now.Before(e.Schedule.End.Add(-lib.Config.Event.FreezeBefore)) {
+		return
+	}
+
+	if state := e.Freeze.snapshot(); !state.FrozenAt.IsZero() {
+		return
+	}
+
+	if err := e.FreezeScoreboard(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to freeze scoreboard: %s", err.Error()))
+	}
+}
+
+// PublicJSON is JSON as the public sees it.
+func (e *Environment) PublicJSON() ([]byte, error) {
+	if state := e.Freeze.snapshot(); state.frozen() {
+		return state.Summary, nil
+	}
+
+	return e.JSON()
+}
+
+// PublicMatrixJSON is MatrixJSON as the public sees it. A frozen board only
+// has the matrix of the default size.
+func (e *Environment) PublicMatrixJSON(n int) ([]byte, error) {
+	if state := e.Freeze.snapshot(); state.frozen() {
+		return state.Matrix, nil
+	}
+
+	return e.MatrixJSON(n)
+}
+
+// PublicHistoryJSON is HistoryJSON as the public sees it, cut off at the
+// freeze and without the details of any result.
+func (e *Environment) PublicHistoryJSON(from, to time.Time, team string, limit int) ([]byte, error) {
+	if state := e.Freeze.snapshot(); state.frozen() && to.After(state.FrozenAt) {
+		to = state.FrozenAt
+	}
+
+	return HistoryJSON(from, to, team, limit, false)
+}
+
+// TeamHistoryJSON is HistoryJSON of team's own rounds with their details,
+// cut off at the freeze like the public history.
+func (e *Environment) TeamHistoryJSON(from, to time.Time, team string, limit int) ([]byte, error) {
+	if state := e.Freeze.snapshot(); state.frozen() && to.After(state.FrozenAt) {
+		to = state.FrozenAt
+	}
+
+	return HistoryJSON(from, to, team, limit, true)
+}
+
+// PublicEventsJSON is EventsJSON as the public sees it, without any event
+// raised after the freeze.
+func (e *Environment) PublicEventsJSON(afterID int64, team, kind string, limit int) ([]byte, error) {
+	var untilID int64
+
+	if state := e.Freeze.snapshot(); state.frozen() {
+		if untilID = state.LastEventID; untilID == 0 {
+			return []byte("[]"), nil
+		}
+	}
+
+	return EventsJSON(afterID, untilID, team, kind, limit)
+}
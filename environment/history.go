@@ -0,0 +1,154 @@
+package environment
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+)
+
+const MaxHistoryRounds = 1000
+
+// HistoryJSON returns the recorded rounds started within [from, to], oldest
+// first, with every check result and the points each team earned per round.
+// Events raised by a round are listed with it and count towards its points.
+// Void rounds are listed without points.
+// With detailed set, results also carry their latency, reason and evidence.
+func HistoryJSON(from, to time.Time, team string, limit int, detailed bool) ([]byte, error) {
+	if limit <= 0 || limit > MaxHistoryRounds {
+		limit = MaxHistoryRounds
+	}
+
+	rounds, err := database.GetRoundsInRange(from, to, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(rounds)
+
+	var results []*database.DBCheckResult
+	var events []*database.DBEvent
+
+	if len(rounds) > 0 {
+		results, err = database.GetCheckResults(rounds[0].ID, rounds[len(rounds)-1].ID, team)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events, err = database.GetRoundEvents(rounds[0].ID, rounds[len(rounds)-1].ID, team)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var resultsByRound map[int64][]*database.DBCheckResult = make(map[int64][]*database.DBCheckResult)
+
+	for _, result := range results {
+		resultsByRound[result.RoundID] = append(resultsByRound[result.RoundID], result)
+	}
+
+	var eventsByRound map[int64][]*database.DBEvent = make(map[int64][]*database.DBEvent)
+
+	for _, event := range events {
+		eventsByRound[event.RoundID] = append(eventsByRound[event.RoundID], event)
+	}
+
+	var roundsJSON []map[string]any = make([]map[string]any, len(rounds))
+
+	for i, round := range rounds {
+		var points map[string]int = make(map[string]int)
+		var roundResults []map[string]any = make([]map[string]any, 0, len(resultsByRound[round.ID]))
+
+		for _, result := range resultsByRound[round.ID] {
+			points[result.Team] += result.Points
+
+			var resultJSON map[string]any = map[string]any{
+				"team":   result.Team,
+				"check":  result.Check,
+				"status": result.Status,
+				"points": result.Points,
+			}
+
+			if result.Multipliers != "" {
+				resultJSON["multiplier"] = result.Multiplier
+				resultJSON["multipliers"] = strings.Split(result.Multipliers, ",")
+			}
+
+			if detailed {
+				resultJSON["latencyMs"] = result.LatencyMS
+				resultJSON["reason"] = result.Reason
+				resultJSON["evidence"] = result.Evidence
+			}
+
+			roundResults = append(roundResults, resultJSON)
+		}
+
+		var roundEvents []*database.DBEvent = eventsByRound[round.ID]
+
+		for _, event := range roundEvents {
+			points[event.Team] += event.Points
+		}
+
+		// A void round's points were never awarded, or were reverted
+		if round.Void() {
+			points = map[string]int{}
+		}
+
+		if roundEvents == nil {
+			roundEvents = []*database.DBEvent{}
+		}
+
+		roundsJSON[i] = map[string]any{
+			"id":         round.ID,
+			"startedAt":  round.StartedAt.Format(time.RFC3339),
+			"finishedAt": formatOptionalTime(round.FinishedAt),
+			"points":     points,
+			"results":    roundResults,
+			"events":     roundEvents,
+			"void":       round.Void(),
+			"voidReason": round.VoidReason,
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"from":   from.Format(time.RFC3339),
+		"to":     to.Format(time.RFC3339),
+		"team":   team,
+		"rounds": roundsJSON,
+	})
+}
+
+func formatOptionalTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+const MaxEvents = 500
+
+// EventsJSON returns up to limit events in (afterID, untilID], newest first.
+// A zero untilID has no upper bound.
+func EventsJSON(afterID, untilID int64, team, kind string, limit int) ([]byte, error) {
+	if limit <= 0 || limit > MaxEvents {
+		limit = MaxEvents
+	}
+
+	events, err := database.GetEvents(afterID, untilID, team, kind, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if events == nil {
+		events = []*database.DBEvent{}
+	}
+
+	return json.Marshal(events)
+}
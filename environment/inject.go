@@ -0,0 +1,202 @@
+package environment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// MaxInjectResponse is the largest response a team may submit, in bytes.
+const MaxInjectResponse = 1 << 20
+
+var ErrInvalidInject = errors.New("invalid inject")
+
+// CreateInject validates and stores a new inject. It is released to the teams
+// automatically once its release time comes.
+func CreateInject(inject *database.DBInject) error {
+	inject.Title = strings.TrimSpace(inject.Title)
+
+	if inject.Title == "" {
+		return fmt.Errorf("%w: a title is required", ErrInvalidInject)
+	}
+
+	if inject.MaxPoints <= 0 {
+		return fmt.Errorf("%w: max points must be positive", ErrInvalidInject)
+	}
+
+	if inject.ReleaseAt.IsZero() || inject.DueAt.IsZero() {
+		return fmt.Errorf("%w: release and due times are required", ErrInvalidInject)
+	}
+
+	if !inject.DueAt.After(inject.ReleaseAt) {
+		return fmt.Errorf("%w: due time must be after release time", ErrInvalidInject)
+	}
+
+	if err := database.CreateInject(inject); err != nil {
+		return err
+	}
+
+	lib.Log.Status(fmt.Sprintf("%s created inject %d (%s), released %s", inject.CreatedBy, inject.ID, inject.Title, inject.ReleaseAt.Format(time.RFC3339)))
+	return nil
+}
+
+// releaseInjects announces the injects whose release time has come.
+func (e *Environment) releaseInjects(now time.Time) {
+	injects, err := database.ReleaseInjects(now)
+
+	if err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to release injects: %s", err.Error()))
+		return
+	}
+
+	for _, inject := range injects {
+		lib.Log.Status(fmt.Sprintf("Released inject %d (%s), due %s", inject.ID, inject.Title, inject.DueAt.Format(time.RFC3339)))
+	}
+}
+
+// InjectToken is the bearer token team submits inject responses with, empty
+// without INJECT_TOKEN_SECRET.
+func InjectToken(team string) string {
+	if lib.Config.Injects.TokenSecret == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(lib.Config.Injects.TokenSecret))
+	mac.Write([]byte("inject:" + team))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// InjectTokenTeam returns the team token is the inject token of, or empty if
+// it is no team's.
+func (e *Environment) InjectTokenTeam(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	for _, container := range e.Containers {
+		expected := InjectToken(container.Team.Name)
+
+		if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return container.Team.Name
+		}
+	}
+
+	return ""
+}
+
+// InjectTokensJSON lists every team's inject token, for admins to hand out.
+func (e *Environment) InjectTokensJSON() ([]byte, error) {
+	if lib.Config.Injects.TokenSecret == "" {
+		return nil, fmt.Errorf("INJECT_TOKEN_SECRET is not set")
+	}
+
+	var tokens map[string]string = make(map[string]string, len(e.Containers))
+
+	for _, container := range e.Containers {
+		tokens[container.Team.Name] = InjectToken(container.Team.Name)
+	}
+
+	return json.Marshal(tokens)
+}
+
+// SubmitInject stores team's response to inject id.
+func (e *Environment) SubmitInject(id int64, team, response string) (*database.DBInjectSubmission, error) {
+	if e.TeamByName(team) == nil {
+		return nil, database.ErrTeamNotFound
+	}
+
+	if strings.TrimSpace(response) == "" {
+		return nil, fmt.Errorf("%w: a response is required", ErrInvalidInject)
+	}
+
+	if len(response) > MaxInjectResponse {
+		return nil, fmt.Errorf("%w: response is larger than %d bytes", ErrInvalidInject, MaxInjectResponse)
+	}
+
+	return database.SubmitInject(id, team, response, time.Now())
+}
+
+// GradeInject grades a submission and adds its points to the team's score.
+func (e *Environment) GradeInject(id int64, points int, comment, actor string) (*database.DBInjectSubmission, error) {
+	submission, _, err := database.GradeInjectSubmission(id, points, comment, actor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.refreshScores(); err != nil {
+		return nil, err
+	}
+
+	if ct := e.TeamByName(submission.Team); ct != nil {
+		e.saveTeam(ct)
+	}
+
+	lib.Log.Status(fmt.Sprintf("[%s]: %s graded inject %d at %d points", submission.Team, actor, submission.InjectID, points))
+
+	return submission, nil
+}
+
+// InjectsJSON lists every inject for admins, or for everyone else only those
+// already released, without who created them.
+func InjectsJSON(all bool) ([]byte, error) {
+	var releasedBy time.Time
+
+	if !all {
+		releasedBy = time.Now()
+	}
+
+	injects, err := database.GetInjects(releasedBy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if all {
+		if injects == nil {
+			injects = []*database.DBInject{}
+		}
+
+		return json.Marshal(injects)
+	}
+
+	var released []map[string]any = make([]map[string]any, len(injects))
+
+	for i, inject := range injects {
+		released[i] = map[string]any{
+			"id":        inject.ID,
+			"title":     inject.Title,
+			"body":      inject.Body,
+			"maxPoints": inject.MaxPoints,
+			"releaseAt": inject.ReleaseAt.Format(time.RFC3339),
+			"dueAt":     inject.DueAt.Format(time.RFC3339),
+		}
+	}
+
+	return json.Marshal(released)
+}
+
+// InjectSubmissionsJSON lists the submissions to inject id by team. A zero id
+// or empty team matches all.
+func InjectSubmissionsJSON(id int64, team string) ([]byte, error) {
+	submissions, err := database.GetInjectSubmissions(id, team)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if submissions == nil {
+		submissions = []*database.DBInjectSubmission{}
+	}
+
+	return json.Marshal(submissions)
+}
@@ -0,0 +1,133 @@
+package environment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+const MaxLedgerEntries = 1000
+
+var ErrInvalidAdjustment = errors.New("invalid adjustment")
+
+// refreshScores sets every team's score to the sum of its ledger entries.
+// Entries written by other processes, e.g. the ledger CLI, are picked up here.
+func (e *Environment) refreshScores() error {
+	totals, err := database.GetLedgerTotals()
+
+	if err != nil {
+		return err
+	}
+
+	e.scoreMutex.Lock()
+	defer e.scoreMutex.Unlock()
+
+	for _, container := range e.Containers {
+		container.Team.Score = totals[container.Team.Name]
+	}
+
+	return nil
+}
+
+// applyLedger records entries and re-derives the scores from the ledger.
+func (e *Environment) applyLedger(entries []*database.DBLedgerEntry) error {
+	if err := database.CreateLedgerEntries(entries); err != nil {
+		return err
+	}
+
+	return e.refreshScores()
+}
+
+func (e *Environment) saveTeam(ct *Container) {
+	if err := database.UpdateTeam(ct.Team); err != nil {
+		lib.Log.Error(fmt.Sprintf("[%s][%s]: Failed to update team in database: %s", ct.Team.Name, ct.Team.ContainerIP, err.Error()))
+	}
+}
+
+// ValidateAdjustment checks a manual adjustment before it is recorded. Only
+// manual and inject entries can be added by hand.
+func ValidateAdjustment(entry *database.DBLedgerEntry) error {
+	switch entry.Source {
+	case database.LedgerSourceManual, database.LedgerSourceInject:
+	default:
+		return fmt.Errorf("%w: source must be %s or %s", ErrInvalidAdjustment, database.LedgerSourceManual, database.LedgerSourceInject)
+	}
+
+	if entry.Amount == 0 {
+		return fmt.Errorf("%w: amount must not be zero", ErrInvalidAdjustment)
+	}
+
+	if entry.Reason == "" {
+		return fmt.Errorf("%w: a reason is required", ErrInvalidAdjustment)
+	}
+
+	return nil
+}
+
+// AdjustScore adds a manual or inject entry to a team's ledger.
+func (e *Environment) AdjustScore(entry *database.DBLedgerEntry) error {
+	if err := ValidateAdjustment(entry); err != nil {
+		return err
+	}
+
+	ct := e.TeamByName(entry.Team)
+
+	if ct == nil {
+		return database.ErrTeamNotFound
+	}
+
+	entry.RoundID = 0
+	entry.Reverts = 0
+
+	if err := e.applyLedger([]*database.DBLedgerEntry{entry}); err != nil {
+		return err
+	}
+
+	e.saveTeam(ct)
+	lib.Log.Status(fmt.Sprintf("[%s]: %s adjusted score by %d (%s): %s", entry.Team, entry.Actor, entry.Amount, entry.Source, entry.Reason))
+
+	return nil
+}
+
+// RevertAdjustment cancels ledger entry id.
+func (e *Environment) RevertAdjustment(id int64, actor, reason string) (*database.DBLedgerEntry, error) {
+	revert, err := database.RevertLedgerEntry(id, actor, reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.refreshScores(); err != nil {
+		return nil, err
+	}
+
+	if ct := e.TeamByName(revert.Team); ct != nil {
+		e.saveTeam(ct)
+	}
+
+	lib.Log.Status(fmt.Sprintf("[%s]: %s reverted ledger entry %d: %s", revert.Team, actor, id, reason))
+
+	return revert, nil
+}
+
+// LedgerJSON returns up to limit ledger entries, newest first.
+func LedgerJSON(team, source string, limit int) ([]byte, error) {
+	if limit <= 0 || limit > MaxLedgerEntries {
+		limit = MaxLedgerEntries
+	}
+
+	entries, err := database.GetLedgerEntries(team, source, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entries == nil {
+		entries = []*database.DBLedgerEntry{}
+	}
+
+	return json.Marshal(entries)
+}
@@ -0,0 +1,142 @@
+package environment
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+)
+
+const (
+	DefaultMatrixRounds = 10
+	MaxMatrixRounds     = 100
+)
+
+// MatrixJSON returns a team x service x round grid of the last n finished
+// rounds, alongside each service's current state, failure streak and overall
+// uptime. A round without a result for a team/service is reported as null.
+func (e *Environment) MatrixJSON(n int) ([]byte, error) {
+	if n <= 0 {
+		n = DefaultMatrixRounds
+	}
+
+	n = min(n, MaxMatrixRounds)
+
+	rounds, err := database.GetRoundsInRange(time.Unix(0, 0), time.Now(), n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(rounds)
+
+	var results []*database.DBCheckResult
+
+	if len(rounds) > 0 {
+		results, err = database.GetCheckResults(rounds[0].ID, rounds[len(rounds)-1].ID, "")
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stats, err := database.GetCheckStats()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var services []string = make([]string, 0, len(ScoringChecks))
+
+	for _, check := range ScoringChecks {
+		services = append(services, check.Name)
+	}
+
+	var roundIndex map[int64]int = make(map[int64]int, len(rounds))
+	var roundsJSON []map[string]any = make([]map[string]any, len(rounds))
+
+	for i, round := range rounds {
+		roundIndex[round.ID] = i
+		roundsJSON[i] = map[string]any{
+			"id":        round.ID,
+			"startedAt": round.StartedAt.Format(time.RFC3339),
+			"void":      round.Void(),
+		}
+	}
+
+	// team -> service -> per-round states
+	var states map[string]map[string][]any = make(map[string]map[string][]any)
+
+	stateRow := func(team, service string) []any {
+		if states[team] == nil {
+			states[team] = make(map[string][]any)
+		}
+
+		if states[team][service] == nil {
+			states[team][service] = make([]any, len(rounds))
+
+			if !slices.Contains(services, service) {
+				services = append(services, service)
+			}
+		}
+
+		return states[team][service]
+	}
+
+	for _, result := range results {
+		stateRow(result.Team, result.Check)[roundIndex[result.RoundID]] = result.Status
+	}
+
+	var statsByTeam map[string]map[string]*database.DBCheckStats = make(map[string]map[string]*database.DBCheckStats)
+
+	for _, stat := range stats {
+		if statsByTeam[stat.Team] == nil {
+			statsByTeam[stat.Team] = make(map[string]*database.DBCheckStats)
+		}
+
+		statsByTeam[stat.Team][stat.Check] = stat
+	}
+
+	var teamsJSON []map[string]any = make([]map[string]any, len(e.Containers))
+
+	for i, container := range e.Containers {
+		var servicesJSON map[string]any = make(map[string]any, len(services))
+
+		for _, service := range services {
+			var row []any = stateRow(container.Team.Name, service)
+			var current any
+
+			if len(row) > 0 {
+				current = row[len(row)-1]
+			}
+
+			var uptime float64 = 1.0
+			var streak int
+
+			if stat := statsByTeam[container.Team.Name][service]; stat != nil && stat.Total > 0 {
+				uptime = math.Round(float64(stat.Up)/float64(stat.Total)*10000) / 10000
+				streak = stat.FailureStreak
+			}
+
+			servicesJSON[service] = map[string]any{
+				"states":  row,
+				"current": current,
+				"streak":  streak,
+				"uptime":  uptime,
+			}
+		}
+
+		teamsJSON[i] = map[string]any{
+			"name":     container.Team.Name,
+			"services": servicesJSON,
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"rounds":   roundsJSON,
+		"services": services,
+		"teams":    teamsJSON,
+	})
+}
@@ -0,0 +1,215 @@
+package environment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+)
+
+// multipliersBlob holds the admin-managed multiplier rules.
+const multipliersBlob = "scoring.multipliers"
+
+var ErrInvalidMultiplier = errors.New("invalid multiplier")
+
+// MultiplierRule scales the reward and/or penalty of one check, or of every
+// check if Check is empty, while it is active. A rule is active between From
+// and Until, and within BeforeEnd of the scheduled end of the event; any of
+// these left unset does not restrict it. Reward and Penalty default to 1.
+type MultiplierRule struct {
+	Name      string     `json:"name"`
+	Check     string     `json:"check,omitempty"`
+	Reward    *float64   `json:"reward,omitempty"`
+	Penalty   *float64   `json:"penalty,omitempty"`
+	From      *time.Time `json:"from,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	BeforeEnd string     `json:"beforeEnd,omitempty"`
+
+	beforeEnd time.Duration
+}
+
+func (r *MultiplierRule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: a name is required", ErrInvalidMultiplier)
+	}
+
+	if (r.Reward != nil && *r.Reward < 0) || (r.Penalty != nil && *r.Penalty < 0) {
+		return fmt.Errorf("%w: %s: multipliers must not be negative", ErrInvalidMultiplier, r.Name)
+	}
+
+	if r.From != nil && r.Until != nil && !r.Until.After(*r.From) {
+		return fmt.Errorf("%w: %s: until must be after from", ErrInvalidMultiplier, r.Name)
+	}
+
+	r.beforeEnd = 0
+
+	if r.BeforeEnd != "" {
+		var err error
+
+		if r.beforeEnd, err = time.ParseDuration(r.BeforeEnd); err != nil || r.beforeEnd <= 0 {
+			return fmt.Errorf("%w: %s: invalid beforeEnd %q", ErrInvalidMultiplier, r.Name, r.BeforeEnd)
+		}
+	}
+
+	return nil
+}
+
+func (r *MultiplierRule) active(now, end time.Time) bool {
+	if r.From != nil && now.Before(*r.From) {
+		return false
+	}
+
+	if r.Until != nil && !now.Before(*r.Until) {
+		return false
+	}
+
+	if r.beforeEnd > 0 && (end.IsZero() || now.Before(end.Add(-r.beforeEnd))) {
+		return false
+	}
+
+	return true
+}
+
+type Multipliers struct {
+	mutex sync.Mutex
+	rules []MultiplierRule
+}
+
+// AppliedMultiplier is the combined effect of the rules active for a check.
+type AppliedMultiplier struct {
+	Reward  float64
+	Penalty float64
+	Rules   []string
+}
+
+// Active combines every rule active for check at now. Overlapping rules
+// multiply.
+func (m *Multipliers) Active(now, end time.Time, check string) AppliedMultiplier {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var applied AppliedMultiplier = AppliedMultiplier{Reward: 1, Penalty: 1}
+
+	for i := range m.rules {
+		rule := &m.rules[i]
+
+		if (rule.Check != "" && rule.Check != check) || !rule.active(now, end) {
+			continue
+		}
+
+		if rule.Reward != nil {
+			applied.Reward *= *rule.Reward
+		}
+
+		if rule.Penalty != nil {
+			applied.Penalty *= *rule.Penalty
+		}
+
+		applied.Rules = append(applied.Rules, rule.Name)
+	}
+
+	return applied
+}
+
+func (m *Multipliers) Rules() []MultiplierRule {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return slices.Clone(m.rules)
+}
+
+// Set validates and stores rules, replacing every existing rule.
+func (m *Multipliers) Set(rules []MultiplierRule) error {
+	var seen map[string]bool = make(map[string]bool)
+
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return err
+		}
+
+		if check := rules[i].Check; check != "" && !slices.ContainsFunc(ScoringChecks, func(c Check) bool { return c.Name == check }) {
+			return fmt.Errorf("%w: %s: unknown check %q", ErrInvalidMultiplier, rules[i].Name, check)
+		}
+
+		if seen[rules[i].Name] {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalidMultiplier, rules[i].Name)
+		}
+
+		seen[rules[i].Name] = true
+	}
+
+	raw, err := json.Marshal(rules)
+
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := database.SetBlob(multipliersBlob, string(raw)); err != nil {
+		return err
+	}
+
+	m.rules = rules
+	return nil
+}
+
+func (e *Environment) pullMultipliersFromDatabase() error {
+	if !database.BlobExists(multipliersBlob) {
+		return nil
+	}
+
+	blob, err := database.GetBlob(multipliersBlob)
+
+	if err != nil {
+		return err
+	}
+
+	var rules []MultiplierRule
+
+	if err := json.Unmarshal([]byte(blob.Value), &rules); err != nil {
+		return err
+	}
+
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	e.Multipliers.mutex.Lock()
+	defer e.Multipliers.mutex.Unlock()
+
+	e.Multipliers.rules = rules
+	return nil
+}
+
+// MultipliersJSON lists every rule and whether it is active right now.
+func (e *Environment) MultipliersJSON() ([]byte, error) {
+	var now time.Time = time.Now()
+	var rules []map[string]any = []map[string]any{}
+
+	for _, rule := range e.Multipliers.Rules() {
+		raw, err := json.Marshal(rule)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var ruleJSON map[string]any
+
+		if err := json.Unmarshal(raw, &ruleJSON); err != nil {
+			return nil, err
+		}
+
+		ruleJSON["active"] = rule.active(now, e.Schedule.End)
+		rules = append(rules, ruleJSON)
+	}
+
+	return json.Marshal(rules)
+}
@@ -0,0 +1,162 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+type ContainerOwnership struct {
+	King     string
+	KingRole string
+	Defended int
+	Captured int
+	Points   int
+}
+
+// readClaim fetches the claim token from a hill. The token is the name of the
+// team that currently owns the box.
+func readClaim(ctx context.Context, ct *Container) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, lib.Config.Scoring.CheckTimeout)
+	defer cancel()
+
+	switch lib.Config.Ownership.Method {
+	case "http":
+		return strings.TrimSpace(lib.HttpGetHostContext(ctx, "http://"+ct.Team.ContainerIP+lib.Config.Ownership.HTTPPath)), nil
+	case "ssh":
+		exit, output, err := lib.SSHClientPool.Run(ctx, ct.Team.ContainerIP, "cat "+lib.Config.Ownership.File, 3)
+
+		if err != nil {
+			return "", err
+		} else if exit != 0 {
+			return "", fmt.Errorf("failed to read claim file (%d): %s", exit, output)
+		}
+
+		return strings.TrimSpace(output), nil
+	}
+
+	return "", fmt.Errorf("unknown ownership method %q", lib.Config.Ownership.Method)
+}
+
+// awardOwnership credits the owner of every claimed hill and returns the
+// resulting ledger entries. claims is indexed like e.Containers. This must run
+// after the round's checks have finished, as it modifies teams other than the
+// hill's own.
+func (e *Environment) awardOwnership(round *database.DBRound, claims []string) []*database.DBLedgerEntry {
+	var ownerships []*database.DBOwnership
+	var entries []*database.DBLedgerEntry
+
+	e.scoreMutex.Lock()
+
+	for i, hill := range e.Containers {
+		hill.Ownership.King = ""
+		hill.Ownership.KingRole = ""
+
+		if claims[i] == "" {
+			continue
+		}
+
+		owner := e.TeamByName(claims[i])
+
+		if owner == nil {
+			continue
+		}
+
+		var role string = database.OwnershipRoleAttacker
+
+		if owner == hill {
+			role = database.OwnershipRoleDefender
+			owner.Ownership.Defended++
+		} else {
+			owner.Ownership.Captured++
+		}
+
+		hill.Ownership.King = owner.Team.Name
+		hill.Ownership.KingRole = role
+
+		owner.Ownership.Points += lib.Config.Ownership.Points
+
+		ownerships = append(ownerships, &database.DBOwnership{
+			RoundID: round.ID,
+			Hill:    hill.Team.Name,
+			Owner:   owner.Team.Name,
+			Role:    role,
+			Points:  lib.Config.Ownership.Points,
+		})
+
+		entries = append(entries, &database.DBLedgerEntry{
+			Team:    owner.Team.Name,
+			Source:  database.LedgerSourceOwnership,
+			Amount:  lib.Config.Ownership.Points,
+			Reason:  fmt.Sprintf("Held %s as %s", hill.Team.Name, role),
+			Actor:   database.LedgerActorSystem,
+			RoundID: round.ID,
+		})
+	}
+
+	e.scoreMutex.Unlock()
+
+	if err := database.CreateOwnerships(ownerships); err != nil {
+		lib.Log.Error(fmt.Sprintf("Failed to record ownership for round %d: %s", round.ID, err.Error()))
+	}
+
+	return entries
+}
+
+func (e *Environment) pullOwnershipFromDatabase() error {
+	latest, err := database.GetLatestOwnerships()
+
+	if err != nil {
+		return err
+	}
+
+	for _, ownership := range latest {
+		if hill := e.TeamByName(ownership.Hill); hill != nil {
+			hill.Ownership.King = ownership.Owner
+			hill.Ownership.KingRole = ownership.Role
+		}
+	}
+
+	return e.refreshOwnershipTotals()
+}
+
+// refreshOwnershipTotals sets every team's defended, captured and points
+// totals from the ownership of rounds that are not void.
+func (e *Environment) refreshOwnershipTotals() error {
+	totals, err := database.GetOwnershipTotals()
+
+	if err != nil {
+		return err
+	}
+
+	e.scoreMutex.Lock()
+	defer e.scoreMutex.Unlock()
+
+	for _, container := range e.Containers {
+		container.Ownership.Defended = 0
+		container.Ownership.Captured = 0
+		container.Ownership.Points = 0
+	}
+
+	for _, total := range totals {
+		owner := e.TeamByName(total.Team)
+
+		if owner == nil {
+			continue
+		}
+
+		switch total.Role {
+		case database.OwnershipRoleDefender:
+			owner.Ownership.Defended += total.Rounds
+		case database.OwnershipRoleAttacker:
+			owner.Ownership.Captured += total.Rounds
+		}
+
+		owner.Ownership.Points += total.Points
+	}
+
+	return nil
+}
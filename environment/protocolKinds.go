@@ -0,0 +1,686 @@
+package environment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/smtp"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jlaffaye/ftp"
+	_ "github.com/lib/pq"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func validatePort(port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %d", port)
+	}
+
+	return nil
+}
+
+func hostPort(c *Container, port int) string {
+	return net.JoinHostPort(c.Team.ContainerIP, fmt.Sprint(port))
+}
+
+type dnsCheckParams struct {
+	Port   int    `json:"port"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Expect string `json:"expect"`
+}
+
+var dnsTypes map[string]dnsmessage.Type = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+// compileDNSCheck asks the container's DNS server for a record. The name is
+// always fully qualified and sent straight to the container, so neither the
+// scorer's hosts file nor its search domains can answer for it. With expect
+// set, one of the answers must equal it.
+func compileDNSCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params dnsCheckParams = dnsCheckParams{
+		Port: 53,
+		Type: "A",
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if err := validatePort(params.Port); err != nil {
+		return nil, err
+	}
+
+	if params.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	params.Type = strings.ToUpper(params.Type)
+	qtype, ok := dnsTypes[params.Type]
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %q", params.Type)
+	}
+
+	if !strings.HasSuffix(params.Name, ".") {
+		params.Name += "."
+	}
+
+	name, err := dnsmessage.NewName(params.Name)
+
+	if err == nil {
+		_, err = packDNSQuery(0, name, qtype)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", params.Name, err)
+	}
+
+	// Names in answers are fully qualified too
+	if qtype == dnsmessage.TypeCNAME || qtype == dnsmessage.TypeMX || qtype == dnsmessage.TypeNS {
+		if params.Expect != "" && !strings.HasSuffix(params.Expect, ".") {
+			params.Expect += "."
+		}
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		response, err := dnsQuery(ctx, hostPort(c, params.Port), name, qtype)
+
+		if err != nil {
+			return checkDown("", "lookup %s %s failed: %s", params.Type, params.Name, err)
+		}
+
+		if response.RCode != dnsmessage.RCodeSuccess {
+			return checkDown("", "lookup %s %s failed: server answered %s", params.Type, params.Name, response.RCode)
+		}
+
+		var answers []string
+
+		for _, answer := range response.Answers {
+			if answer.Header.Type != qtype {
+				continue
+			}
+
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				answers = append(answers, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				answers = append(answers, net.IP(body.AAAA[:]).String())
+			case *dnsmessage.CNAMEResource:
+				answers = append(answers, body.CNAME.String())
+			case *dnsmessage.MXResource:
+				answers = append(answers, body.MX.String())
+			case *dnsmessage.NSResource:
+				answers = append(answers, body.NS.String())
+			case *dnsmessage.TXTResource:
+				answers = append(answers, strings.Join(body.TXT, ""))
+			}
+		}
+
+		var evidence string = strings.Join(answers, "\n")
+
+		if len(answers) == 0 {
+			return checkDown(evidence, "no %s records for %s", params.Type, params.Name)
+		}
+
+		if params.Expect != "" && !slices.Contains(answers, params.Expect) {
+			return checkDown(evidence, "%s %s did not resolve to %s", params.Type, params.Name, params.Expect)
+		}
+
+		return checkUp(evidence)
+	}, nil
+}
+
+// dnsQuery asks server for the records of name over UDP, asking again over
+// TCP if the answer did not fit.
+func dnsQuery(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	var id uint16 = uint16(rand.Uint32())
+
+	query, err := packDNSQuery(id, name, qtype)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := dnsExchange(ctx, "udp", server, query)
+
+	if err == nil && response.Truncated {
+		response, err = dnsExchange(ctx, "tcp", server, query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !response.Response || response.ID != id {
+		return nil, fmt.Errorf("answer does not match the query")
+	}
+
+	return response, nil
+}
+
+func packDNSQuery(id uint16, name dnsmessage.Name, qtype dnsmessage.Type) ([]byte, error) {
+	return (&dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}).Pack()
+}
+
+func dnsExchange(ctx context.Context, network, server string, query []byte) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, network, server)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	defer stop()
+
+	var answer []byte
+
+	if network == "tcp" {
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(query)))); err != nil {
+			return nil, err
+		}
+
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+
+		var length [2]byte
+
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+
+		answer = make([]byte, binary.BigEndian.Uint16(length[:]))
+
+		if _, err := io.ReadFull(conn, answer); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+
+		answer = make([]byte, 4096)
+		n, err := conn.Read(answer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		answer = answer[:n]
+	}
+
+	var response dnsmessage.Message
+
+	if err := response.Unpack(answer); err != nil {
+		return nil, fmt.Errorf("malformed answer: %w", err)
+	}
+
+	return &response, nil
+}
+
+type smtpCheckParams struct {
+	Port   int    `json:"port"`
+	Helo   string `json:"helo"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Banner string `json:"banner"`
+}
+
+// compileSMTPCheck completes an SMTP handshake and, with from and to set,
+// has the server accept a recipient without sending any mail.
+func compileSMTPCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params smtpCheckParams = smtpCheckParams{
+		Port: 25,
+		Helo: "koth.local",
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if err := validatePort(params.Port); err != nil {
+		return nil, err
+	}
+
+	if (params.From == "") != (params.To == "") {
+		return nil, fmt.Errorf("from and to must be set together")
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		var dialer net.Dialer
+
+		conn, err := dialer.DialContext(ctx, "tcp", hostPort(c, params.Port))
+
+		if err != nil {
+			return checkDown("", "connection failed: %s", err)
+		}
+
+		defer conn.Close()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		// Read the banner ourselves, smtp.NewClient discards it
+		var banner []byte = make([]byte, 512)
+		n, err := conn.Read(banner)
+
+		if err != nil {
+			return checkDown("", "no banner: %s", err)
+		}
+
+		var evidence string = strings.TrimSpace(string(banner[:n]))
+
+		if !strings.HasPrefix(evidence, "220") {
+			return checkDown(evidence, "unexpected banner")
+		}
+
+		if params.Banner != "" && !strings.Contains(evidence, params.Banner) {
+			return checkDown(evidence, "banner does not contain %q", params.Banner)
+		}
+
+		client, err := smtp.NewClient(&prereadConn{Conn: conn, data: banner[:n]}, c.Team.ContainerIP)
+
+		if err != nil {
+			return checkDown(evidence, "handshake failed: %s", err)
+		}
+
+		defer client.Close()
+
+		if err := client.Hello(params.Helo); err != nil {
+			return checkDown(evidence, "HELO rejected: %s", err)
+		}
+
+		if params.From != "" {
+			if err := client.Mail(params.From); err != nil {
+				return checkDown(evidence, "MAIL FROM rejected: %s", err)
+			}
+
+			if err := client.Rcpt(params.To); err != nil {
+				return checkDown(evidence, "RCPT TO rejected: %s", err)
+			}
+
+			client.Reset()
+		}
+
+		client.Quit()
+
+		return checkUp(evidence)
+	}, nil
+}
+
+// prereadConn replays data that was already read from Conn.
+type prereadConn struct {
+	net.Conn
+	data []byte
+}
+
+func (c *prereadConn) Read(p []byte) (int, error) {
+	if len(c.data) > 0 {
+		n := copy(p, c.data)
+		c.data = c.data[n:]
+		return n, nil
+	}
+
+	return c.Conn.Read(p)
+}
+
+type ftpCheckParams struct {
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Path     string `json:"path"`
+	Expect   string `json:"expect"`
+}
+
+// compileFTPCheck logs in and lists a directory. With expect set, the
+// listing must contain an entry of that name.
+func compileFTPCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params ftpCheckParams = ftpCheckParams{
+		Port:     21,
+		Username: "anonymous",
+		Password: "anonymous",
+		Path:     "/",
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if err := validatePort(params.Port); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		options := []ftp.DialOption{ftp.DialWithContext(ctx)}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			options = append(options, ftp.DialWithTimeout(time.Until(deadline)))
+		}
+
+		conn, err := ftp.Dial(hostPort(c, params.Port), options...)
+
+		if err != nil {
+			return checkDown("", "connection failed: %s", err)
+		}
+
+		stop := context.AfterFunc(ctx, func() {
+			conn.Quit()
+		})
+
+		defer stop()
+		defer conn.Quit()
+
+		if err := conn.Login(params.Username, params.Password); err != nil {
+			return checkDown("", "login as %s failed: %s", params.Username, err)
+		}
+
+		entries, err := conn.List(params.Path)
+
+		if err != nil {
+			return checkDown("", "listing %s failed: %s", params.Path, err)
+		}
+
+		var names []string = make([]string, 0, len(entries))
+
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+
+		var evidence string = strings.Join(names, "\n")
+
+		if params.Expect != "" && !slices.Contains(names, params.Expect) {
+			return checkDown(evidence, "%s does not contain %s", params.Path, params.Expect)
+		}
+
+		return checkUp(evidence)
+	}, nil
+}
+
+type sqlCheckParams struct {
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Database string `json:"database"`
+	Query    string `json:"query"`
+	Expect   string `json:"expect"`
+	SSLMode  string `json:"sslmode"`
+}
+
+// runSQLCheck runs params.Query and reports the first row as evidence. With
+// expect set, one of the row's columns must equal it.
+func runSQLCheck(ctx context.Context, driver, dsn string, params sqlCheckParams) CheckResult {
+	db, err := sql.Open(driver, dsn)
+
+	if err != nil {
+		return checkDown("", "invalid connection settings: %s", err)
+	}
+
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, params.Query)
+
+	if err != nil {
+		return checkDown("", "query failed: %s", err)
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+
+	if err != nil {
+		return checkDown("", "query failed: %s", err)
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return checkDown("", "query failed: %s", err)
+		}
+
+		return checkDown("", "query returned no rows")
+	}
+
+	var values []sql.NullString = make([]sql.NullString, len(columns))
+	var pointers []any = make([]any, len(columns))
+
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	if err := rows.Scan(pointers...); err != nil {
+		return checkDown("", "failed to read row: %s", err)
+	}
+
+	var row []string = make([]string, len(values))
+
+	for i, value := range values {
+		row[i] = value.String
+	}
+
+	var evidence string = strings.Join(row, "\t")
+
+	if params.Expect != "" && !slices.Contains(row, params.Expect) {
+		return checkDown(evidence, "first row does not contain %q", params.Expect)
+	}
+
+	return checkUp(evidence)
+}
+
+func compileSQLParams(raw json.RawMessage, port int) (sqlCheckParams, error) {
+	var params sqlCheckParams = sqlCheckParams{
+		Port:  port,
+		Query: "SELECT 1",
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return params, err
+	}
+
+	if err := validatePort(params.Port); err != nil {
+		return params, err
+	}
+
+	if params.Username == "" {
+		return params, fmt.Errorf("username is required")
+	}
+
+	return params, nil
+}
+
+func compileMySQLCheck(raw json.RawMessage) (CheckFunction, error) {
+	params, err := compileSQLParams(raw, 3306)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if params.SSLMode != "" {
+		return nil, fmt.Errorf("sslmode is only supported for postgres")
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		config := mysql.NewConfig()
+		config.User = params.Username
+		config.Passwd = params.Password
+		config.Net = "tcp"
+		config.Addr = hostPort(c, params.Port)
+		config.DBName = params.Database
+
+		return runSQLCheck(ctx, "mysql", config.FormatDSN(), params)
+	}, nil
+}
+
+func compilePostgresCheck(raw json.RawMessage) (CheckFunction, error) {
+	params, err := compileSQLParams(raw, 5432)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if params.SSLMode == "" {
+		params.SSLMode = "disable"
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(params.Username, params.Password),
+			Host:     hostPort(c, params.Port),
+			Path:     "/" + params.Database,
+			RawQuery: url.Values{"sslmode": {params.SSLMode}}.Encode(),
+		}
+
+		return runSQLCheck(ctx, "postgres", dsn.String(), params)
+	}, nil
+}
+
+type ldapCheckParams struct {
+	Port       int    `json:"port"`
+	TLS        bool   `json:"tls"`
+	BindDN     string `json:"bindDN"`
+	Password   string `json:"password"`
+	BaseDN     string `json:"baseDN"`
+	Filter     string `json:"filter"`
+	Attribute  string `json:"attribute"`
+	Expect     string `json:"expect"`
+	MinResults int    `json:"minResults"`
+}
+
+// compileLDAPCheck binds (anonymously without bindDN) and searches the
+// subtree at baseDN. With expect set, an entry's attribute, or its DN if no
+// attribute is given, must equal it.
+func compileLDAPCheck(raw json.RawMessage) (CheckFunction, error) {
+	var params ldapCheckParams = ldapCheckParams{
+		Port:       389,
+		Filter:     "(objectClass=*)",
+		MinResults: 1,
+	}
+
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	if err := validatePort(params.Port); err != nil {
+		return nil, err
+	}
+
+	if params.BaseDN == "" {
+		return nil, fmt.Errorf("baseDN is required")
+	}
+
+	if _, err := ldap.CompileFilter(params.Filter); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	var scheme string = "ldap"
+
+	if params.TLS {
+		scheme = "ldaps"
+	}
+
+	return func(ctx context.Context, _ *Environment, c *Container) CheckResult {
+		var dialer net.Dialer
+
+		if deadline, ok := ctx.Deadline(); ok {
+			dialer.Deadline = deadline
+		}
+
+		conn, err := ldap.DialURL(scheme+"://"+hostPort(c, params.Port), ldap.DialWithDialer(&dialer))
+
+		if err != nil {
+			return checkDown("", "connection failed: %s", err)
+		}
+
+		defer conn.Close()
+
+		stop := context.AfterFunc(ctx, func() {
+			conn.Close()
+		})
+
+		defer stop()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetTimeout(time.Until(deadline))
+		}
+
+		if params.BindDN != "" {
+			err = conn.Bind(params.BindDN, params.Password)
+		} else {
+			err = conn.UnauthenticatedBind("")
+		}
+
+		if err != nil {
+			return checkDown("", "bind failed: %s", err)
+		}
+
+		var attributes []string
+
+		if params.Attribute != "" {
+			attributes = []string{params.Attribute}
+		}
+
+		result, err := conn.Search(ldap.NewSearchRequest(params.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, params.Filter, attributes, nil))
+
+		if err != nil {
+			return checkDown("", "search failed: %s", err)
+		}
+
+		var values []string
+
+		for _, entry := range result.Entries {
+			if params.Attribute != "" {
+				values = append(values, entry.GetAttributeValues(params.Attribute)...)
+			} else {
+				values = append(values, entry.DN)
+			}
+		}
+
+		var evidence string = strings.Join(values, "\n")
+
+		if len(result.Entries) < params.MinResults {
+			return checkDown(evidence, "search returned %d entries, expected at least %d", len(result.Entries), params.MinResults)
+		}
+
+		if params.Expect != "" && !slices.Contains(values, params.Expect) {
+			return checkDown(evidence, "no entry matched %q", params.Expect)
+		}
+
+		return checkUp(evidence)
+	}, nil
+}
@@ -0,0 +1,793 @@
+package environment
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"golang.org/x/net/dns/dnsmessage"
+	"koth.cyber.cs.unh.edu/database"
+)
+
+// The protocol checks run against stand-in servers on 127.0.0.1 that speak
+// just enough of each protocol for the client to get through a check.
+
+var localContainer *Container = &Container{
+	Team: &database.DBTeam{ContainerIP: "127.0.0.1"},
+}
+
+// runCheck compiles a check of kind with params and runs it once against
+// localContainer.
+func runCheck(t *testing.T, kind string, params map[string]any) CheckResult {
+	t.Helper()
+
+	raw, err := json.Marshal(params)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := checkKinds[kind](raw)
+
+	if err != nil {
+		t.Fatalf("compile %s check: %s", kind, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return check(ctx, nil, localContainer)
+}
+
+func expectUp(t *testing.T, result CheckResult) {
+	t.Helper()
+
+	if result.Status != database.CheckStatusUp {
+		t.Fatalf("expected up, got %s: %s (evidence %q)", result.Status, result.Reason, result.Evidence)
+	}
+}
+
+func expectDown(t *testing.T, result CheckResult, reason string) {
+	t.Helper()
+
+	if result.Status != database.CheckStatusDown {
+		t.Fatalf("expected down, got %s (evidence %q)", result.Status, result.Evidence)
+	}
+
+	if !strings.Contains(result.Reason, reason) {
+		t.Fatalf("expected reason containing %q, got %q", reason, result.Reason)
+	}
+}
+
+// closedPort returns a port nothing is listening on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+// serveTCP accepts connections on a random port and hands each to handle
+// until the test ends.
+func serveTCP(t *testing.T, handle func(conn net.Conn)) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				handle(conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// serveDNS answers A queries for www.team.koth. with address and every other
+// name with NXDOMAIN. TXT answers are only given over TCP.
+func serveDNS(t *testing.T, address [4]byte) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		var buffer []byte = make([]byte, 512)
+
+		for {
+			n, from, err := conn.ReadFrom(buffer)
+
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+
+			if err := query.Unpack(buffer[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+
+			var question dnsmessage.Question = query.Questions[0]
+			var response dnsmessage.Message = dnsmessage.Message{
+				Header: dnsmessage.Header{
+					ID:            query.ID,
+					Response:      true,
+					Authoritative: true,
+				},
+				Questions: query.Questions,
+			}
+
+			switch {
+			case question.Type == dnsmessage.TypeTXT:
+				// Too long for UDP, ask again over TCP
+				response.Truncated = true
+			case question.Name.String() != "www.team.koth.":
+				response.RCode = dnsmessage.RCodeNameError
+			case question.Type == dnsmessage.TypeA:
+				response.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{
+						Name:  question.Name,
+						Type:  dnsmessage.TypeA,
+						Class: dnsmessage.ClassINET,
+						TTL:   60,
+					},
+					Body: &dnsmessage.AResource{A: address},
+				}}
+			}
+
+			packed, err := response.Pack()
+
+			if err != nil {
+				continue
+			}
+
+			conn.WriteTo(packed, from)
+		}
+	}()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			var length [2]byte
+			var query dnsmessage.Message
+			var buffer []byte
+
+			if _, err := io.ReadFull(conn, length[:]); err == nil {
+				buffer = make([]byte, binary.BigEndian.Uint16(length[:]))
+				_, err = io.ReadFull(conn, buffer)
+			}
+
+			if err := query.Unpack(buffer); err == nil && len(query.Questions) == 1 {
+				response := dnsmessage.Message{
+					Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+					Questions: query.Questions,
+					Answers: []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{
+							Name:  query.Questions[0].Name,
+							Type:  dnsmessage.TypeTXT,
+							Class: dnsmessage.ClassINET,
+							TTL:   60,
+						},
+						Body: &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}},
+					}},
+				}
+
+				if packed, err := response.Pack(); err == nil {
+					conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...))
+				}
+			}
+
+			conn.Close()
+		}
+	}()
+
+	return port
+}
+
+func TestDNSCheck(t *testing.T) {
+	port := serveDNS(t, [4]byte{10, 0, 0, 5})
+
+	t.Run("up", func(t *testing.T) {
+		// Not fully qualified, the check must not apply search domains
+		result := runCheck(t, "dns", map[string]any{"port": port, "name": "www.team.koth", "expect": "10.0.0.5"})
+		expectUp(t, result)
+
+		if result.Evidence != "10.0.0.5" {
+			t.Fatalf("expected the answer as evidence, got %q", result.Evidence)
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		expectDown(t, runCheck(t, "dns", map[string]any{"port": closedPort(t), "name": "www.team.koth"}), "lookup A www.team.koth. failed")
+	})
+
+	t.Run("wrong answer", func(t *testing.T) {
+		expectDown(t, runCheck(t, "dns", map[string]any{"port": port, "name": "www.team.koth", "expect": "10.0.0.6"}), "did not resolve to 10.0.0.6")
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+		expectDown(t, runCheck(t, "dns", map[string]any{"port": port, "name": "mail.team.koth"}), "server answered RCodeNameError")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		expectUp(t, runCheck(t, "dns", map[string]any{"port": port, "name": "team.koth", "type": "TXT", "expect": "v=spf1 -all"}))
+	})
+
+	t.Run("no records", func(t *testing.T) {
+		expectDown(t, runCheck(t, "dns", map[string]any{"port": port, "name": "www.team.koth", "type": "MX"}), "no MX records")
+	})
+}
+
+// serveSMTP greets with banner and accepts any recipient but root.
+func serveSMTP(t *testing.T, banner string) int {
+	t.Helper()
+
+	return serveTCP(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "%s\r\n", banner)
+
+		if !strings.HasPrefix(banner, "220") {
+			return
+		}
+
+		for {
+			line, err := reader.ReadString('\n')
+
+			if err != nil {
+				return
+			}
+
+			command, argument, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+			switch strings.ToUpper(command) {
+			case "EHLO":
+				fmt.Fprintf(conn, "250-mail.team.koth\r\n250 HELP\r\n")
+			case "HELO", "MAIL", "RSET":
+				fmt.Fprintf(conn, "250 OK\r\n")
+			case "RCPT":
+				if strings.Contains(argument, "root@") {
+					fmt.Fprintf(conn, "550 No such user\r\n")
+				} else {
+					fmt.Fprintf(conn, "250 OK\r\n")
+				}
+			case "QUIT":
+				fmt.Fprintf(conn, "221 Bye\r\n")
+				return
+			default:
+				fmt.Fprintf(conn, "502 Not implemented\r\n")
+			}
+		}
+	})
+}
+
+func TestSMTPCheck(t *testing.T) {
+	port := serveSMTP(t, "220 mail.team.koth ESMTP Postfix")
+
+	t.Run("up", func(t *testing.T) {
+		result := runCheck(t, "smtp", map[string]any{"port": port, "banner": "Postfix", "from": "scorer@koth.local", "to": "admin@team.koth"})
+		expectUp(t, result)
+
+		if result.Evidence != "220 mail.team.koth ESMTP Postfix" {
+			t.Fatalf("expected the banner as evidence, got %q", result.Evidence)
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		expectDown(t, runCheck(t, "smtp", map[string]any{"port": closedPort(t)}), "connection failed")
+	})
+
+	t.Run("wrong banner", func(t *testing.T) {
+		expectDown(t, runCheck(t, "smtp", map[string]any{"port": port, "banner": "Exim"}), `banner does not contain "Exim"`)
+	})
+
+	t.Run("refused greeting", func(t *testing.T) {
+		expectDown(t, runCheck(t, "smtp", map[string]any{"port": serveSMTP(t, "554 No SMTP service here")}), "unexpected banner")
+	})
+
+	t.Run("rejected recipient", func(t *testing.T) {
+		expectDown(t, runCheck(t, "smtp", map[string]any{"port": port, "from": "scorer@koth.local", "to": "root@team.koth"}), "RCPT TO rejected")
+	})
+}
+
+// serveFTP lets anonymous log in and lists a single pub directory.
+func serveFTP(t *testing.T) int {
+	t.Helper()
+
+	return serveTCP(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "220 FTP ready\r\n")
+
+		var user string
+		var data net.Listener
+
+		defer func() {
+			if data != nil {
+				data.Close()
+			}
+		}()
+
+		for {
+			line, err := reader.ReadString('\n')
+
+			if err != nil {
+				return
+			}
+
+			command, argument, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+			switch strings.ToUpper(command) {
+			case "USER":
+				user = argument
+				fmt.Fprintf(conn, "331 Password required\r\n")
+			case "PASS":
+				if user != "anonymous" {
+					fmt.Fprintf(conn, "530 Login incorrect\r\n")
+				} else {
+					fmt.Fprintf(conn, "230 Logged in\r\n")
+				}
+			case "TYPE", "OPTS":
+				fmt.Fprintf(conn, "200 OK\r\n")
+			case "EPSV":
+				if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+					fmt.Fprintf(conn, "425 Cannot open data connection\r\n")
+					continue
+				}
+
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%d|)\r\n", data.Addr().(*net.TCPAddr).Port)
+			case "LIST":
+				if data == nil {
+					fmt.Fprintf(conn, "425 Use EPSV first\r\n")
+					continue
+				}
+
+				fmt.Fprintf(conn, "150 Here comes the listing\r\n")
+
+				if dataConn, err := data.Accept(); err == nil {
+					fmt.Fprintf(dataConn, "drwxr-xr-x 2 ftp ftp 4096 Jan 01 12:00 pub\r\n")
+					dataConn.Close()
+				}
+
+				data.Close()
+				data = nil
+				fmt.Fprintf(conn, "226 Directory send OK\r\n")
+			case "QUIT":
+				fmt.Fprintf(conn, "221 Bye\r\n")
+				return
+			default:
+				fmt.Fprintf(conn, "502 Not implemented\r\n")
+			}
+		}
+	})
+}
+
+func TestFTPCheck(t *testing.T) {
+	port := serveFTP(t)
+
+	t.Run("up", func(t *testing.T) {
+		result := runCheck(t, "ftp", map[string]any{"port": port, "expect": "pub"})
+		expectUp(t, result)
+
+		if result.Evidence != "pub" {
+			t.Fatalf("expected the listing as evidence, got %q", result.Evidence)
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		expectDown(t, runCheck(t, "ftp", map[string]any{"port": closedPort(t)}), "connection failed")
+	})
+
+	t.Run("missing entry", func(t *testing.T) {
+		expectDown(t, runCheck(t, "ftp", map[string]any{"port": port, "expect": "incoming"}), "/ does not contain incoming")
+	})
+
+	t.Run("rejected login", func(t *testing.T) {
+		expectDown(t, runCheck(t, "ftp", map[string]any{"port": port, "username": "root", "password": "toor"}), "login as root failed")
+	})
+}
+
+// mysqlPacket writes payload as a MySQL packet with sequence number sequence.
+func mysqlPacket(w io.Writer, sequence byte, payload []byte) {
+	var header [4]byte
+	binary.LittleEndian.PutUint32(header[:], uint32(len(payload)))
+	header[3] = sequence
+	w.Write(append(header[:], payload...))
+}
+
+func readMySQLPacket(r io.Reader) ([]byte, error) {
+	var header [4]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	var payload []byte = make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+func mysqlString(value string) []byte {
+	return append([]byte{byte(len(value))}, value...)
+}
+
+// serveMySQL lets scorer log in with any password and answers every query
+// with a single row holding value.
+func serveMySQL(t *testing.T, value string) int {
+	t.Helper()
+
+	return serveTCP(t, func(conn net.Conn) {
+		var capabilities uint32 = 0x00000001 | 0x00000008 | 0x00000200 | 0x00008000 | 0x00080000
+
+		var handshake []byte = []byte{10}
+		handshake = append(handshake, "8.0.36\x00"...)
+		handshake = binary.LittleEndian.AppendUint32(handshake, 1)
+		handshake = append(handshake, "abcdefgh\x00"...)
+		handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities))
+		handshake = append(handshake, 33)
+		handshake = binary.LittleEndian.AppendUint16(handshake, 2)
+		handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities>>16))
+		handshake = append(handshake, 21)
+		handshake = append(handshake, make([]byte, 10)...)
+		handshake = append(handshake, "ijklmnopqrst\x00"...)
+		handshake = append(handshake, "mysql_native_password\x00"...)
+		mysqlPacket(conn, 0, handshake)
+
+		login, err := readMySQLPacket(conn)
+
+		// The user name follows the capabilities, packet size, charset and
+		// 23 reserved bytes
+		if err != nil || len(login) < 32 {
+			return
+		}
+
+		user, _, _ := strings.Cut(string(login[32:]), "\x00")
+
+		if user != "scorer" {
+			mysqlPacket(conn, 2, append([]byte{0xff, 0x15, 0x04}, "#28000Access denied for user"...))
+			return
+		}
+
+		var ok []byte = []byte{0x00, 0, 0, 2, 0, 0, 0}
+		var eof []byte = []byte{0xfe, 0, 0, 2, 0}
+		mysqlPacket(conn, 2, ok)
+
+		for {
+			command, err := readMySQLPacket(conn)
+
+			if err != nil || len(command) == 0 || command[0] == 0x01 {
+				return
+			}
+
+			if command[0] != 0x03 {
+				mysqlPacket(conn, 1, ok)
+				continue
+			}
+
+			var column []byte
+			column = append(column, mysqlString("def")...)
+			column = append(column, mysqlString("")...)
+			column = append(column, mysqlString("")...)
+			column = append(column, mysqlString("")...)
+			column = append(column, mysqlString("value")...)
+			column = append(column, mysqlString("")...)
+			column = append(column, 0x0c, 33, 0)
+			column = binary.LittleEndian.AppendUint32(column, 255)
+			column = append(column, 0xfd, 0, 0, 0, 0, 0)
+
+			mysqlPacket(conn, 1, []byte{1})
+			mysqlPacket(conn, 2, column)
+			mysqlPacket(conn, 3, eof)
+			mysqlPacket(conn, 4, mysqlString(value))
+			mysqlPacket(conn, 5, eof)
+		}
+	})
+}
+
+func TestMySQLCheck(t *testing.T) {
+	port := serveMySQL(t, "scoreboard")
+
+	t.Run("up", func(t *testing.T) {
+		result := runCheck(t, "mysql", map[string]any{"port": port, "username": "scorer", "password": "secret", "query": "SELECT name FROM sites", "expect": "scoreboard"})
+		expectUp(t, result)
+
+		if result.Evidence != "scoreboard" {
+			t.Fatalf("expected the first row as evidence, got %q", result.Evidence)
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		expectDown(t, runCheck(t, "mysql", map[string]any{"port": closedPort(t), "username": "scorer"}), "query failed")
+	})
+
+	t.Run("wrong row", func(t *testing.T) {
+		expectDown(t, runCheck(t, "mysql", map[string]any{"port": port, "username": "scorer", "expect": "wordpress"}), `first row does not contain "wordpress"`)
+	})
+
+	t.Run("rejected login", func(t *testing.T) {
+		expectDown(t, runCheck(t, "mysql", map[string]any{"port": port, "username": "root"}), "Access denied")
+	})
+}
+
+// postgresMessage writes a backend message of type kind.
+func postgresMessage(w io.Writer, kind byte, body []byte) {
+	var message []byte = []byte{kind}
+	message = binary.BigEndian.AppendUint32(message, uint32(len(body)+4))
+	w.Write(append(message, body...))
+}
+
+// servePostgres trusts scorer and answers every simple query with a single
+// text row holding value.
+func servePostgres(t *testing.T, value string) int {
+	t.Helper()
+
+	return serveTCP(t, func(conn net.Conn) {
+		var length [4]byte
+
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+
+		var startup []byte = make([]byte, binary.BigEndian.Uint32(length[:])-4)
+
+		if _, err := io.ReadFull(conn, startup); err != nil || len(startup) < 4 {
+			return
+		}
+
+		var parameters []string = strings.Split(string(startup[4:]), "\x00")
+		var user string
+
+		for i := 0; i+1 < len(parameters); i += 2 {
+			if parameters[i] == "user" {
+				user = parameters[i+1]
+			}
+		}
+
+		if user != "scorer" {
+			postgresMessage(conn, 'E', []byte("SFATAL\x00C28P01\x00Mpassword authentication failed for user \""+user+"\"\x00\x00"))
+			return
+		}
+
+		postgresMessage(conn, 'R', []byte{0, 0, 0, 0})
+		postgresMessage(conn, 'S', []byte("server_version\x0016.2\x00"))
+		postgresMessage(conn, 'Z', []byte{'I'})
+
+		for {
+			var header [5]byte
+
+			if _, err := io.ReadFull(conn, header[:]); err != nil {
+				return
+			}
+
+			var body []byte = make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+
+			if _, err := io.ReadFull(conn, body); err != nil || header[0] != 'Q' {
+				return
+			}
+
+			var description []byte = binary.BigEndian.AppendUint16(nil, 1)
+			description = append(description, "value\x00"...)
+			description = binary.BigEndian.AppendUint32(description, 0)
+			description = binary.BigEndian.AppendUint16(description, 0)
+			description = binary.BigEndian.AppendUint32(description, 25)
+			description = binary.BigEndian.AppendUint16(description, 0xffff)
+			description = binary.BigEndian.AppendUint32(description, 0xffffffff)
+			description = binary.BigEndian.AppendUint16(description, 0)
+
+			var row []byte = binary.BigEndian.AppendUint16(nil, 1)
+			row = binary.BigEndian.AppendUint32(row, uint32(len(value)))
+			row = append(row, value...)
+
+			postgresMessage(conn, 'T', description)
+			postgresMessage(conn, 'D', row)
+			postgresMessage(conn, 'C', []byte("SELECT 1\x00"))
+			postgresMessage(conn, 'Z', []byte{'I'})
+		}
+	})
+}
+
+func TestPostgresCheck(t *testing.T) {
+	port := servePostgres(t, "scoreboard")
+
+	t.Run("up", func(t *testing.T) {
+		result := runCheck(t, "postgres", map[string]any{"port": port, "username": "scorer", "database": "app", "query": "SELECT name FROM sites", "expect": "scoreboard"})
+		expectUp(t, result)
+
+		if result.Evidence != "scoreboard" {
+			t.Fatalf("expected the first row as evidence, got %q", result.Evidence)
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		expectDown(t, runCheck(t, "postgres", map[string]any{"port": closedPort(t), "username": "scorer"}), "query failed")
+	})
+
+	t.Run("wrong row", func(t *testing.T) {
+		expectDown(t, runCheck(t, "postgres", map[string]any{"port": port, "username": "scorer", "expect": "wordpress"}), `first row does not contain "wordpress"`)
+	})
+
+	t.Run("rejected login", func(t *testing.T) {
+		expectDown(t, runCheck(t, "postgres", map[string]any{"port": port, "username": "root"}), "password authentication failed")
+	})
+}
+
+// ldapResult builds an LDAPResult-shaped response to message id.
+func ldapResult(id int64, application ber.Tag, code uint16) *ber.Packet {
+	var packet *ber.Packet = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+
+	var result *ber.Packet = ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	packet.AppendChild(result)
+	return packet
+}
+
+// serveLDAP allows anonymous and cn=admin binds with password secret, and
+// answers every search with the entries in people.
+func serveLDAP(t *testing.T, people map[string]string) int {
+	t.Helper()
+
+	return serveTCP(t, func(conn net.Conn) {
+		for {
+			request, err := ber.ReadPacket(conn)
+
+			if err != nil || len(request.Children) < 2 {
+				return
+			}
+
+			id, _ := request.Children[0].Value.(int64)
+			var operation *ber.Packet = request.Children[1]
+
+			switch operation.Tag {
+			case ldap.ApplicationBindRequest:
+				var code uint16 = ldap.LDAPResultSuccess
+				dn := operation.Children[1].Data.String()
+				password := operation.Children[2].Data.String()
+
+				if dn != "" && (dn != "cn=admin,dc=team,dc=koth" || password != "secret") {
+					code = ldap.LDAPResultInvalidCredentials
+				}
+
+				conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+			case ldap.ApplicationSearchRequest:
+				for dn, uid := range people {
+					var packet *ber.Packet = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+					packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+
+					var entry *ber.Packet = ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+					entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+
+					var attribute *ber.Packet = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+					attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "uid", ""))
+
+					var values *ber.Packet = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+					values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, uid, ""))
+					attribute.AppendChild(values)
+
+					var attributes *ber.Packet = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+					attributes.AppendChild(attribute)
+					entry.AppendChild(attributes)
+					packet.AppendChild(entry)
+
+					conn.Write(packet.Bytes())
+				}
+
+				conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+			default:
+				return
+			}
+		}
+	})
+}
+
+func TestLDAPCheck(t *testing.T) {
+	port := serveLDAP(t, map[string]string{"uid=alice,ou=people,dc=team,dc=koth": "alice"})
+
+	t.Run("up", func(t *testing.T) {
+		result := runCheck(t, "ldap", map[string]any{"port": port, "baseDN": "dc=team,dc=koth", "attribute": "uid", "expect": "alice"})
+		expectUp(t, result)
+
+		if result.Evidence != "alice" {
+			t.Fatalf("expected the attribute values as evidence, got %q", result.Evidence)
+		}
+	})
+
+	t.Run("bound", func(t *testing.T) {
+		expectUp(t, runCheck(t, "ldap", map[string]any{"port": port, "bindDN": "cn=admin,dc=team,dc=koth", "password": "secret", "baseDN": "dc=team,dc=koth"}))
+	})
+
+	t.Run("down", func(t *testing.T) {
+		expectDown(t, runCheck(t, "ldap", map[string]any{"port": closedPort(t), "baseDN": "dc=team,dc=koth"}), "connection failed")
+	})
+
+	t.Run("wrong entry", func(t *testing.T) {
+		expectDown(t, runCheck(t, "ldap", map[string]any{"port": port, "baseDN": "dc=team,dc=koth", "attribute": "uid", "expect": "bob"}), `no entry matched "bob"`)
+	})
+
+	t.Run("rejected bind", func(t *testing.T) {
+		expectDown(t, runCheck(t, "ldap", map[string]any{"port": port, "bindDN": "cn=admin,dc=team,dc=koth", "password": "wrong", "baseDN": "dc=team,dc=koth"}), "bind failed")
+	})
+
+	t.Run("no entries", func(t *testing.T) {
+		expectDown(t, runCheck(t, "ldap", map[string]any{"port": serveLDAP(t, nil), "baseDN": "dc=team,dc=koth"}), "search returned 0 entries, expected at least 1")
+	})
+}
+
+func TestCompileProtocolChecks(t *testing.T) {
+	var invalid map[string]string = map[string]string{
+		"dns":      `{"name": "www.team.koth", "type": "SRV"}`,
+		"smtp":     `{"from": "scorer@koth.local"}`,
+		"ftp":      `{"port": 70000}`,
+		"mysql":    `{"password": "secret"}`,
+		"postgres": `{"username": "scorer", "bogus": true}`,
+		"ldap":     `{"baseDN": "dc=team,dc=koth", "filter": "uid=alice"}`,
+	}
+
+	for kind, raw := range invalid {
+		if _, err := checkKinds[kind](json.RawMessage(raw)); err == nil {
+			t.Errorf("%s check with %s compiled", kind, raw)
+		}
+	}
+
+	if _, err := checkKinds["dns"](json.RawMessage(`{"name": "` + strings.Repeat("a", 64) + `.koth"}`)); err == nil {
+		t.Errorf("dns check with an oversized label compiled")
+	}
+
+}
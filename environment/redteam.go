@@ -0,0 +1,204 @@
+package environment
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+var ErrRedTeamDisabled = errors.New("red team is disabled")
+
+// FlagLocation is where a flag is planted on every box.
+type FlagLocation struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// RedTeam plants flags on every box and credits the red team for the ones it
+// submits. A nil RedTeam is disabled.
+type RedTeam struct {
+	Name   string
+	Points int
+	Flags  []FlagLocation
+
+	token string
+}
+
+// LoadRedTeam reads the red team from lib.Config.RedTeam, or returns nil if it
+// is disabled.
+func LoadRedTeam() (*RedTeam, error) {
+	if !lib.Config.RedTeam.Enabled {
+		return nil, nil
+	}
+
+	var redTeam *RedTeam = &RedTeam{
+		Name:   lib.Config.RedTeam.Name,
+		Points: lib.Config.RedTeam.Points,
+		token:  lib.Config.RedTeam.Token,
+	}
+
+	if redTeam.Name == "" || redTeam.token == "" {
+		return nil, fmt.Errorf("RED_TEAM_NAME and RED_TEAM_TOKEN are required")
+	}
+
+	if redTeam.Points <= 0 {
+		return nil, fmt.Errorf("RED_TEAM_POINTS must be positive")
+	}
+
+	for _, pair := range strings.Split(lib.Config.RedTeam.Flags, ",") {
+		name, flagPath, ok := strings.Cut(strings.TrimSpace(pair), "=")
+
+		if !ok || name == "" || !path.IsAbs(flagPath) || strings.ContainsAny(flagPath, " '\"$`;&|<>\\") {
+			return nil, fmt.Errorf("invalid red team flag %q, expected name=/absolute/path", pair)
+		}
+
+		for _, flag := range redTeam.Flags {
+			if flag.Name == name {
+				return nil, fmt.Errorf("red team flag %q is defined twice", name)
+			}
+		}
+
+		redTeam.Flags = append(redTeam.Flags, FlagLocation{Name: name, Path: flagPath})
+	}
+
+	return redTeam, nil
+}
+
+func (r *RedTeam) Enabled() bool {
+	return r != nil
+}
+
+// Authorize reports whether token is the red team's submission token.
+func (r *RedTeam) Authorize(token string) bool {
+	return r.Enabled() && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) == 1
+}
+
+// plantFlags writes a new secret to every flag location on a freshly
+// initialized box, readable by root only, and stores them for submissions.
+func (e *Environment) plantFlags(conn *lib.SSHConnection, teamName string) error {
+	var flags []*database.DBFlag = make([]*database.DBFlag, len(e.RedTeam.Flags))
+
+	for i, location := range e.RedTeam.Flags {
+		var value string = lib.RandomString(16)
+
+		if value == "" {
+			return fmt.Errorf("failed to generate flag %s", location.Name)
+		}
+
+		value = "KOTH{" + value + "}"
+
+		if exit, output, err := conn.SendWithOutput(fmt.Sprintf("mkdir -p %s && printf '%%s\\n' '%s' > %s && chmod 600 %s", path.Dir(location.Path), value, location.Path, location.Path)); err != nil {
+			return fmt.Errorf("failed to plant flag %s: %w", location.Name, err)
+		} else if exit != 0 {
+			return fmt.Errorf("failed to plant flag %s (%d): %s", location.Name, exit, output)
+		}
+
+		flags[i] = &database.DBFlag{
+			Name:  location.Name,
+			Path:  location.Path,
+			Value: value,
+		}
+	}
+
+	return database.ReplaceFlags(teamName, flags)
+}
+
+// CaptureFlag credits the red team with a submitted flag, taking the points
+// from the team whose box it was planted on.
+func (e *Environment) CaptureFlag(value, actor string) (*database.DBFlag, error) {
+	if !e.RedTeam.Enabled() {
+		return nil, ErrRedTeamDisabled
+	}
+
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return nil, database.ErrFlagNotFound
+	}
+
+	flag, _, err := database.CaptureFlag(value, e.RedTeam.Name, actor, e.RedTeam.Points)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.refreshScores(); err != nil {
+		return nil, err
+	}
+
+	if ct := e.TeamByName(flag.Team); ct != nil {
+		e.saveTeam(ct)
+	}
+
+	lib.Log.Warning(fmt.Sprintf("[%s]: %s captured flag %s for %d points", flag.Team, e.RedTeam.Name, flag.Name, flag.Points))
+
+	return flag, nil
+}
+
+// RedTeamJSON reports the red team's captures up to until, or all of them if
+// until is zero. Flag values are left out so the board cannot leak them.
+func (e *Environment) RedTeamJSON(until time.Time) ([]byte, error) {
+	if !e.RedTeam.Enabled() {
+		return nil, ErrRedTeamDisabled
+	}
+
+	flags, err := database.GetCapturedFlags(until)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var captures []map[string]any = make([]map[string]any, len(flags))
+	var score int
+
+	for i, flag := range flags {
+		captures[i] = map[string]any{
+			"team":       flag.Team,
+			"flag":       flag.Name,
+			"points":     flag.Points,
+			"capturedAt": flag.CapturedAt.Format(time.RFC3339),
+		}
+
+		score += flag.Points
+	}
+
+	return json.Marshal(map[string]any{
+		"team":     e.RedTeam.Name,
+		"score":    score,
+		"captures": captures,
+	})
+}
+
+// PublicRedTeamJSON is RedTeamJSON as of the freeze while the scoreboard is
+// frozen.
+func (e *Environment) PublicRedTeamJSON() ([]byte, error) {
+	var until time.Time
+
+	if state := e.Freeze.snapshot(); state.frozen() {
+		until = state.FrozenAt
+	}
+
+	return e.RedTeamJSON(until)
+}
+
+// FlagsJSON lists every planted flag with its value, for admins.
+func FlagsJSON(team string) ([]byte, error) {
+	flags, err := database.GetFlags(team)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if flags == nil {
+		flags = []*database.DBFlag{}
+	}
+
+	return json.Marshal(flags)
+}
@@ -0,0 +1,142 @@
+package environment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+var ErrChecksChanged = errors.New("the checks file changed since the server started, restart it before rescoring")
+
+// RescoreReport is the difference rescoring makes, per team and check in
+// Changes and per team and round in Entries, the ledger entries that apply
+// it.
+type RescoreReport struct {
+	Applied bool                        `json:"applied"`
+	Changes []*database.DBRescoreChange `json:"changes"`
+	Entries []*database.DBLedgerEntry   `json:"entries"`
+}
+
+// rescorePoints scores a stored result again with the current weights of its
+// check. Results of checks that no longer exist, and partial results stored
+// without their credit, are kept as they are.
+func rescorePoints(checks []Check) func(*database.DBCheckResult) (int, bool) {
+	var byName map[string]Check = make(map[string]Check, len(checks))
+
+	for _, check := range checks {
+		byName[check.Name] = check
+	}
+
+	return func(result *database.DBCheckResult) (int, bool) {
+		check, ok := byName[result.Check]
+
+		if !ok {
+			return 0, false
+		}
+
+		if result.Status == database.CheckStatusPartial {
+			if result.Credit == nil {
+				return 0, false
+			}
+
+			return check.Points(result.Status, result.Multiplier, *result.Credit), true
+		}
+
+		return check.Points(result.Status, result.Multiplier, 0), true
+	}
+}
+
+// RescoreHistory recomputes every stored check result with the weights in
+// ScoringChecks, keeping the multipliers that applied at the time. Without
+// apply it only reports the difference.
+func RescoreHistory(apply bool, actor, reason string) (*RescoreReport, error) {
+	if apply && reason == "" {
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidAdjustment)
+	}
+
+	changes, entries, err := database.RescoreCheckResults(rescorePoints(ScoringChecks), apply, actor, reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if changes == nil {
+		changes = []*database.DBRescoreChange{}
+	}
+
+	if entries == nil {
+		entries = []*database.DBLedgerEntry{}
+	}
+
+	return &RescoreReport{
+		Applied: apply,
+		Changes: changes,
+		Entries: entries,
+	}, nil
+}
+
+// checksFileUnchanged reads the checks file again and fails with
+// ErrChecksChanged when it no longer matches the checks the rounds run with.
+// Swapping the checks of a running server mid-round is not safe, so new
+// weights only take effect after a restart.
+func checksFileUnchanged() error {
+	checks, err := readScoringChecks(lib.Config.Scoring.ChecksFile)
+
+	if err != nil {
+		return err
+	}
+
+	current, err := json.Marshal(checks)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(current, ScoringJSON) {
+		return ErrChecksChanged
+	}
+
+	return nil
+}
+
+// Rescore is RescoreHistory for the running environment, updating the
+// scores it holds once the change is applied. It refuses to rescore with
+// weights other than the checks file's.
+func (e *Environment) Rescore(apply bool, actor, reason string) (*RescoreReport, error) {
+	if err := checksFileUnchanged(); err != nil {
+		return nil, err
+	}
+
+	report, err := RescoreHistory(apply, actor, reason)
+
+	if err != nil || !apply {
+		return report, err
+	}
+
+	if err := e.refreshScores(); err != nil {
+		return nil, err
+	}
+
+	var teams []string
+
+	for _, entry := range report.Entries {
+		if slices.Contains(teams, entry.Team) {
+			continue
+		}
+
+		teams = append(teams, entry.Team)
+
+		if ct := e.TeamByName(entry.Team); ct != nil {
+			e.saveTeam(ct)
+		}
+	}
+
+	lib.Log.Status(fmt.Sprintf("%s rescored history, %d teams changed: %s", actor, len(teams), reason))
+
+	return report, nil
+}
@@ -0,0 +1,263 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+const (
+	PhasePending = "pending"
+	PhaseRunning = "running"
+	PhaseBreak   = "break"
+	PhasePaused  = "paused"
+	PhaseEnded   = "ended"
+)
+
+// pausedBlob holds the time the event was manually paused, so a pause
+// survives a restart.
+const pausedBlob = "schedule.paused"
+
+type Break struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Schedule decides when scoring rounds may run. A zero Start or End leaves
+// that side of the event open.
+type Schedule struct {
+	Start  time.Time
+	End    time.Time
+	Breaks []Break
+
+	mutex    sync.Mutex
+	pausedAt time.Time
+}
+
+func parseScheduleTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+
+	return t, nil
+}
+
+// LoadSchedule builds the schedule from lib.Config.Event and restores a
+// pause left in the database.
+func LoadSchedule() (*Schedule, error) {
+	var schedule *Schedule = &Schedule{}
+	var err error
+
+	if schedule.Start, err = parseScheduleTime("event start", lib.Config.Event.Start); err != nil {
+		return nil, err
+	}
+
+	if schedule.End, err = parseScheduleTime("event end", lib.Config.Event.End); err != nil {
+		return nil, err
+	}
+
+	if !schedule.Start.IsZero() && !schedule.End.IsZero() && !schedule.End.After(schedule.Start) {
+		return nil, fmt.Errorf("event end must be after event start")
+	}
+
+	if lib.Config.Event.Breaks != "" {
+		for _, pair := range strings.Split(lib.Config.Event.Breaks, ",") {
+			start, end, ok := strings.Cut(pair, "/")
+
+			if !ok {
+				return nil, fmt.Errorf("invalid break %q, expected start/end", pair)
+			}
+
+			var b Break
+
+			if b.Start, err = parseScheduleTime("break start", start); err != nil {
+				return nil, err
+			}
+
+			if b.End, err = parseScheduleTime("break end", end); err != nil {
+				return nil, err
+			}
+
+			if b.Start.IsZero() || !b.End.After(b.Start) {
+				return nil, fmt.Errorf("invalid break %q, end must be after start", pair)
+			}
+
+			schedule.Breaks = append(schedule.Breaks, b)
+		}
+
+		slices.SortFunc(schedule.Breaks, func(a, b Break) int {
+			return a.Start.Compare(b.Start)
+		})
+	}
+
+	if database.BlobExists(pausedBlob) {
+		blob, err := database.GetBlob(pausedBlob)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if schedule.pausedAt, err = time.Parse(time.RFC3339, blob.Value); err != nil {
+			return nil, fmt.Errorf("invalid pause state %q: %w", blob.Value, err)
+		}
+	}
+
+	return schedule, nil
+}
+
+func (s *Schedule) Paused() (bool, time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return !s.pausedAt.IsZero(), s.pausedAt
+}
+
+// Pause stops new rounds from starting until Resume is called. A round that
+// is already running is allowed to finish.
+func (s *Schedule) Pause() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.pausedAt.IsZero() {
+		return nil
+	}
+
+	now := time.Now()
+
+	if _, err := database.CreateBlob(pausedBlob, now.Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	s.pausedAt = now
+
+	return nil
+}
+
+func (s *Schedule) Resume() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pausedAt.IsZero() {
+		return nil
+	}
+
+	if err := database.DeleteBlob(pausedBlob); err != nil {
+		return err
+	}
+
+	s.pausedAt = time.Time{}
+
+	return nil
+}
+
+func (s *Schedule) currentBreak(now time.Time) *Break {
+	for i, b := range s.Breaks {
+		if !now.Before(b.Start) && now.Before(b.End) {
+			return &s.Breaks[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *Schedule) Phase(now time.Time) string {
+	if paused, _ := s.Paused(); paused {
+		return PhasePaused
+	}
+
+	if !s.Start.IsZero() && now.Before(s.Start) {
+		return PhasePending
+	}
+
+	if !s.End.IsZero() && !now.Before(s.End) {
+		return PhaseEnded
+	}
+
+	if s.currentBreak(now) != nil {
+		return PhaseBreak
+	}
+
+	return PhaseRunning
+}
+
+// NextChange returns when the phase at now is scheduled to end. It is zero if
+// the phase only ends manually or never.
+func (s *Schedule) NextChange(now time.Time) time.Time {
+	switch s.Phase(now) {
+	case PhasePending:
+		return s.Start
+	case PhaseBreak:
+		return s.currentBreak(now).End
+	case PhaseRunning:
+		for _, b := range s.Breaks {
+			if b.Start.After(now) && (s.End.IsZero() || b.Start.Before(s.End)) {
+				return b.Start
+			}
+		}
+
+		return s.End
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) status() map[string]any {
+	var now time.Time = time.Now()
+	var next time.Time = s.NextChange(now)
+	var remaining any
+
+	if !next.IsZero() {
+		remaining = int64(next.Sub(now).Seconds())
+	}
+
+	var breaks []map[string]string = make([]map[string]string, len(s.Breaks))
+
+	for i, b := range s.Breaks {
+		breaks[i] = map[string]string{
+			"start": b.Start.Format(time.RFC3339),
+			"end":   b.End.Format(time.RFC3339),
+		}
+	}
+
+	_, pausedAt := s.Paused()
+
+	return map[string]any{
+		"phase":         s.Phase(now),
+		"now":           now.Format(time.RFC3339),
+		"start":         formatOptionalTime(s.Start),
+		"end":           formatOptionalTime(s.End),
+		"breaks":        breaks,
+		"pausedAt":      formatOptionalTime(pausedAt),
+		"nextChange":    formatOptionalTime(next),
+		"remaining":     remaining,
+		"roundInterval": int64(lib.Config.Scoring.RoundInterval.Seconds()),
+	}
+}
+
+// ScheduleJSON returns the event's schedule, its current phase and whether
+// the scoreboard is frozen.
+func (e *Environment) ScheduleJSON() ([]byte, error) {
+	var status map[string]any = e.Schedule.status()
+
+	frozen, frozenAt := e.Frozen()
+	status["frozen"] = frozen
+	status["frozenAt"] = nil
+
+	if frozen {
+		status["frozenAt"] = frozenAt.Format(time.RFC3339)
+	}
+
+	return json.Marshal(status)
+}
@@ -1,145 +1,281 @@
 package environment
 
 import (
+	"context"
 	"encoding/json"
-	"io"
-	"net/http"
+	"errors"
+	"fmt"
+	"math"
+	"os"
 	"strings"
+	"time"
 
+	"koth.cyber.cs.unh.edu/database"
 	"koth.cyber.cs.unh.edu/lib"
 )
 
+var ErrUnknownCheckKind = errors.New("unknown check kind")
+
+// MaxEvidenceLength caps the evidence kept for a single check result.
+const MaxEvidenceLength = 512
+
+// CheckResult is what a check reports about a container. Check functions only
+// set Status to up, down or partial; RunCheck fills in the latency and reports
+// checks that miss their deadline as timeouts. Credit is the share of the
+// reward a partial result earns.
+type CheckResult struct {
+	Status   string
+	Latency  time.Duration
+	Reason   string
+	Evidence string
+	Credit   float64
+}
+
+func checkUp(evidence string) CheckResult {
+	return CheckResult{Status: database.CheckStatusUp, Evidence: evidence}
+}
+
+func checkDown(evidence, format string, args ...any) CheckResult {
+	return CheckResult{Status: database.CheckStatusDown, Reason: fmt.Sprintf(format, args...), Evidence: evidence}
+}
+
+func checkPartial(credit float64, evidence, format string, args ...any) CheckResult {
+	return CheckResult{Status: database.CheckStatusPartial, Reason: fmt.Sprintf(format, args...), Evidence: evidence, Credit: credit}
+}
+
+func truncateEvidence(evidence string) string {
+	if len(evidence) <= MaxEvidenceLength {
+		return evidence
+	}
+
+	return strings.ToValidUTF8(evidence[:MaxEvidenceLength], "") + "..."
+}
+
+type CheckFunction func(context.Context, *Environment, *Container) CheckResult
+
 type Check struct {
-	Name          string                              `json:"name"`
-	Desc          string                              `json:"desc"`
-	Reward        int                                 `json:"reward"`
-	Penalty       int                                 `json:"penalty"`
-	CheckFunction func(*Environment, *Container) bool `json:"-"`
+	Name          string        `json:"name"`
+	Desc          string        `json:"desc"`
+	Kind          string        `json:"kind"`
+	Reward        int           `json:"reward"`
+	Penalty       int           `json:"penalty"`
+	Uptime        bool          `json:"uptime"`
+	SLA           SLARule       `json:"sla"`
+	DependsOn     []string      `json:"dependsOn,omitempty"`
+	SkipPenalty   int           `json:"skipPenalty"`
+	Every         int           `json:"-"`
+	Jitter        time.Duration `json:"-"`
+	Timeout       time.Duration `json:"-"`
+	CheckFunction CheckFunction `json:"-"`
 }
 
-var ScoringChecks []Check = []Check{
-	{
-		Name:    "Ping",
-		Desc:    "Check if the container is reachable",
-		Reward:  3,
-		Penalty: 1,
-		CheckFunction: func(_ *Environment, c *Container) bool {
-			return lib.PingHost(c.Team.ContainerIP)
-		},
-	},
-	{
-		Name:    "Nginx Status",
-		Desc:    "Check if the container is running Nginx by asking the webserver for content",
-		Reward:  2,
-		Penalty: 2,
-		CheckFunction: func(e *Environment, c *Container) bool {
-			res, err := http.Get("http://" + c.Team.ContainerIP)
-
-			if err != nil || res.StatusCode != 200 {
-				return false
-			}
+// CheckDefinition is a single entry in the checks file. Params are decoded by
+// the compiler registered for Kind in checkKinds. A check is skipped, costing
+// SkipPenalty instead of Penalty, in rounds where a check it depends on is not
+// up; dependencies must be defined earlier in the file. A check with an
+// Interval longer than a round only runs every few rounds, and starts at a
+// random point in the first Jitter of the rounds it runs in.
+type CheckDefinition struct {
+	Name        string          `json:"name"`
+	Desc        string          `json:"desc"`
+	Kind        string          `json:"kind"`
+	Reward      int             `json:"reward"`
+	Penalty     int             `json:"penalty"`
+	Uptime      bool            `json:"uptime,omitempty"`
+	SLA         *SLARule        `json:"sla,omitempty"`
+	DependsOn   []string        `json:"dependsOn,omitempty"`
+	SkipPenalty int             `json:"skipPenalty,omitempty"`
+	Interval    string          `json:"interval,omitempty"`
+	Jitter      string          `json:"jitter,omitempty"`
+	Timeout     string          `json:"timeout,omitempty"`
+	Params      json.RawMessage `json:"params,omitempty"`
+}
 
-			defer res.Body.Close()
-			rawBody, err := io.ReadAll(res.Body)
-
-			return err == nil && len(rawBody) >= 16
-		},
-	},
-	{
-		Name:    "Root can log in",
-		Desc:    "Check if the root user can log in via SSH using the private key",
-		Reward:  1,
-		Penalty: 1,
-		CheckFunction: func(e *Environment, c *Container) bool {
-			client, err := lib.NewSSHConnectionWithRetries(c.Team.ContainerIP, 3)
-
-			if err != nil {
-				return false
-			}
+var ScoringChecks []Check = []Check{}
+var ScoringJSON []byte = []byte("[]")
 
-			defer client.Close()
-			return client.Send("whoami") == nil
-
-		},
-	},
-	{
-		Name:    "API Availability",
-		Desc:    "Query database entries from API",
-		Reward:  3,
-		Penalty: 1,
-		CheckFunction: func(e *Environment, c *Container) bool {
-			res, err := http.Get("http://" + c.Team.ContainerIP + ":5000/get-messages")
-
-			if err != nil || res.StatusCode != 200 {
-				return false
-			}
+func CompileCheck(def CheckDefinition) (Check, error) {
+	if def.Name == "" {
+		return Check{}, fmt.Errorf("check is missing a name")
+	}
 
-			defer res.Body.Close()
-			rawBody, err := io.ReadAll(res.Body)
+	compiler, ok := checkKinds[def.Kind]
 
-			if err != nil {
-				return false
-			}
+	if !ok {
+		return Check{}, fmt.Errorf("check %s: %w: %q", def.Name, ErrUnknownCheckKind, def.Kind)
+	}
 
-			var jsonData []any
-			return json.Unmarshal(rawBody, &jsonData) == nil
-		},
-	},
-	{
-		Name:    "Prometheus",
-		Desc:    "Make sure the Prometheus services are online",
-		Reward:  5,
-		Penalty: 5,
-		CheckFunction: func(e *Environment, c *Container) bool {
-			client, err := lib.NewSSHConnectionWithRetries(c.Team.ContainerIP, 3)
-
-			if err != nil {
-				return false
-			}
+	params := def.Params
 
-			defer client.Close()
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
 
-			if statusCode, response, err := client.SendWithOutput("systemctl status prometheus"); err != nil || statusCode != 0 || !strings.Contains(response, "active (running)") {
-				return false
-			}
+	checkFunction, err := compiler(params)
 
-			client.Close()
-			client, err = lib.NewSSHConnectionWithRetries(c.Team.ContainerIP, 3)
+	if err != nil {
+		return Check{}, fmt.Errorf("check %s: %w", def.Name, err)
+	}
 
-			if err != nil {
-				return false
-			}
+	var timeout time.Duration = lib.Config.Scoring.CheckTimeout
 
-			defer client.Close()
+	if def.Timeout != "" {
+		if timeout, err = time.ParseDuration(def.Timeout); err != nil || timeout <= 0 {
+			return Check{}, fmt.Errorf("check %s: invalid timeout %q", def.Name, def.Timeout)
+		}
+	}
 
-			if statusCode, response, err := client.SendWithOutput("systemctl status node_exporter"); err != nil || statusCode != 0 || !strings.Contains(response, "active (running)") {
-				return false
-			}
+	var sla SLARule = SLARule{
+		Failures: lib.Config.SLA.Failures,
+		Penalty:  lib.Config.SLA.Penalty,
+	}
 
-			return true
-		},
-	},
-	{
-		Name:    "Grafana",
-		Desc:    "Make sure the Grafana service is online",
-		Reward:  5,
-		Penalty: 1,
-		CheckFunction: func(e *Environment, c *Container) bool {
-			client, err := lib.NewSSHConnectionWithRetries(c.Team.ContainerIP, 3)
-
-			if err != nil {
-				return false
-			}
+	if def.SLA != nil {
+		sla = *def.SLA
+	}
+
+	if sla.Failures < 0 || sla.Penalty < 0 {
+		return Check{}, fmt.Errorf("check %s: invalid sla rule", def.Name)
+	}
+
+	if def.SkipPenalty < 0 {
+		return Check{}, fmt.Errorf("check %s: skipPenalty must not be negative", def.Name)
+	}
+
+	var every int = 1
+
+	if def.Interval != "" {
+		interval, err := time.ParseDuration(def.Interval)
+
+		if err != nil || interval <= 0 {
+			return Check{}, fmt.Errorf("check %s: invalid interval %q", def.Name, def.Interval)
+		}
+
+		every = max(1, int(math.Ceil(float64(interval)/float64(lib.Config.Scoring.RoundInterval))))
+	}
+
+	var jitter time.Duration = lib.Config.Scoring.Jitter
+
+	if def.Jitter != "" {
+		if jitter, err = time.ParseDuration(def.Jitter); err != nil || jitter < 0 {
+			return Check{}, fmt.Errorf("check %s: invalid jitter %q", def.Name, def.Jitter)
+		}
+	}
+
+	return Check{
+		Name:          def.Name,
+		Desc:          def.Desc,
+		Kind:          def.Kind,
+		Reward:        def.Reward,
+		Penalty:       def.Penalty,
+		Uptime:        def.Uptime,
+		SLA:           sla,
+		DependsOn:     def.DependsOn,
+		SkipPenalty:   def.SkipPenalty,
+		Every:         every,
+		Jitter:        jitter,
+		Timeout:       timeout,
+		CheckFunction: checkFunction,
+	}, nil
+}
 
-			defer client.Close()
+func CompileChecks(defs []CheckDefinition) ([]Check, error) {
+	var checks []Check = make([]Check, 0, len(defs))
+	var seen map[string]bool = make(map[string]bool)
 
-			if statusCode, response, err := client.SendWithOutput("systemctl status grafana-server"); err != nil || statusCode != 0 || !strings.Contains(response, "active (running)") {
-				return false
+	for _, def := range defs {
+		if seen[def.Name] {
+			return nil, fmt.Errorf("duplicate check name %q", def.Name)
+		}
+
+		for _, dependency := range def.DependsOn {
+			if !seen[dependency] {
+				return nil, fmt.Errorf("check %s depends on %q, which is not defined before it", def.Name, dependency)
 			}
+		}
+
+		seen[def.Name] = true
+
+		check, err := CompileCheck(def)
+
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// Points scores a result of the check. multiplier is the reward multiplier
+// for up and partial results and the penalty multiplier otherwise; credit is
+// only used for partial results.
+func (check Check) Points(status string, multiplier, credit float64) int {
+	switch status {
+	case database.CheckStatusUp:
+		return int(math.Round(float64(check.Reward) * multiplier))
+	case database.CheckStatusPartial:
+		return int(math.Round(float64(check.Reward) * multiplier * credit))
+	case database.CheckStatusSkipped:
+		return -int(math.Round(float64(check.SkipPenalty) * multiplier))
+	}
+
+	return -int(math.Round(float64(check.Penalty) * multiplier))
+}
+
+// unmetDependency returns the first check this one depends on that was not up
+// this round, or an empty string if there is none.
+func (check Check) unmetDependency(statuses map[string]string) string {
+	for _, dependency := range check.DependsOn {
+		if !database.CheckStatusIsUp(statuses[dependency]) {
+			return dependency
+		}
+	}
+
+	return ""
+}
+
+func LoadScoringChecks(path string) error {
+	checks, err := readScoringChecks(path)
+
+	if err != nil {
+		return err
+	}
+
+	ScoringChecks = checks
+	ScoringJSON = scoringToJSON()
+
+	return nil
+}
 
-			return true
-		},
-	},
+// readScoringChecks reads and compiles the checks file at path without
+// changing the checks in use.
+func readScoringChecks(path string) ([]Check, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		lib.Log.Warning(fmt.Sprintf("Checks file %s not found, using checks.example.json", path))
+		path = "./checks.example.json"
+	}
+
+	raw, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checks file: %w", err)
+	}
+
+	var defs []CheckDefinition
+
+	if err := json.Unmarshal(raw, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse checks file %s: %w", path, err)
+	}
+
+	checks, err := CompileChecks(defs)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile checks file %s: %w", path, err)
+	}
+
+	return checks, nil
 }
 
 func scoringToJSON() []byte {
@@ -152,4 +288,41 @@ func scoringToJSON() []byte {
 	return bytes
 }
 
-var ScoringJSON = scoringToJSON()
+// RunCheck runs a check under its own deadline, derived from parent. A check
+// that does not return before the deadline is abandoned and reported as a
+// timeout, so a single unresponsive team cannot hold up the round.
+func (e *Environment) RunCheck(parent context.Context, check Check, ct *Container) CheckResult {
+	ctx, cancel := context.WithTimeout(parent, check.Timeout)
+	defer cancel()
+
+	var started time.Time = time.Now()
+	var done chan CheckResult = make(chan CheckResult, 1)
+
+	go func() {
+		done <- check.CheckFunction(ctx, e, ct)
+	}()
+
+	var result CheckResult
+
+	select {
+	case result = <-done:
+		if result.Status == database.CheckStatusDown && ctx.Err() != nil {
+			result.Status = database.CheckStatusTimeout
+		}
+	case <-ctx.Done():
+		result = CheckResult{Status: database.CheckStatusTimeout}
+	}
+
+	result.Latency = time.Since(started)
+	result.Evidence = truncateEvidence(result.Evidence)
+
+	if result.Status == database.CheckStatusTimeout {
+		if ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+			result.Reason = fmt.Sprintf("no response within %s", check.Timeout)
+		} else {
+			result.Reason = "round ended before the check finished"
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,123 @@
+package environment
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"koth.cyber.cs.unh.edu/database"
+)
+
+// SLARule charges Penalty extra points every time a check fails Failures
+// rounds in a row. A rule with no failures never triggers.
+type SLARule struct {
+	Failures int `json:"failures"`
+	Penalty  int `json:"penalty"`
+}
+
+// ServiceSLA tracks one check on one container across every round.
+type ServiceSLA struct {
+	Total      int `json:"total"`
+	Up         int `json:"up"`
+	Streak     int `json:"streak"`
+	Violations int `json:"violations"`
+}
+
+func (s ServiceSLA) Uptime() float64 {
+	if s.Total == 0 {
+		return 1.0
+	}
+
+	return math.Round(float64(s.Up)/float64(s.Total)*10000) / 10000
+}
+
+func (ct *Container) serviceSLA(check string) *ServiceSLA {
+	if ct.SLA == nil {
+		ct.SLA = make(map[string]*ServiceSLA)
+	}
+
+	if ct.SLA[check] == nil {
+		ct.SLA[check] = &ServiceSLA{}
+	}
+
+	return ct.SLA[check]
+}
+
+// recordSLA adds a round's status for check and returns the resulting SLA
+// violation, if any.
+func (ct *Container) recordSLA(round *database.DBRound, check Check, status string) *database.DBEvent {
+	ct.slaMutex.Lock()
+	defer ct.slaMutex.Unlock()
+
+	sla := ct.serviceSLA(check.Name)
+	sla.Total++
+
+	if database.CheckStatusIsUp(status) {
+		sla.Up++
+		sla.Streak = 0
+		return nil
+	}
+
+	sla.Streak++
+
+	if check.SLA.Failures <= 0 || sla.Streak%check.SLA.Failures != 0 {
+		return nil
+	}
+
+	sla.Violations++
+
+	return &database.DBEvent{
+		RoundID:   round.ID,
+		CreatedAt: time.Now(),
+		Kind:      database.EventKindSLAViolation,
+		Team:      ct.Team.Name,
+		Subject:   check.Name,
+		Points:    -check.SLA.Penalty,
+		Message:   fmt.Sprintf("%s failed %d rounds in a row", check.Name, sla.Streak),
+	}
+}
+
+// SLASnapshot copies the container's per-check SLA state.
+func (ct *Container) SLASnapshot() map[string]ServiceSLA {
+	ct.slaMutex.Lock()
+	defer ct.slaMutex.Unlock()
+
+	var snapshot map[string]ServiceSLA = make(map[string]ServiceSLA, len(ct.SLA))
+
+	for check, sla := range ct.SLA {
+		snapshot[check] = *sla
+	}
+
+	return snapshot
+}
+
+func (e *Environment) pullSLAFromDatabase() error {
+	stats, err := database.GetCheckStats()
+
+	if err != nil {
+		return err
+	}
+
+	for _, stat := range stats {
+		if ct := e.TeamByName(stat.Team); ct != nil {
+			sla := ct.serviceSLA(stat.Check)
+			sla.Total = stat.Total
+			sla.Up = stat.Up
+			sla.Streak = stat.FailureStreak
+		}
+	}
+
+	counts, err := database.GetEventCounts(database.EventKindSLAViolation)
+
+	if err != nil {
+		return err
+	}
+
+	for _, count := range counts {
+		if ct := e.TeamByName(count.Team); ct != nil {
+			ct.serviceSLA(count.Subject).Violations = count.Count
+		}
+	}
+
+	return nil
+}
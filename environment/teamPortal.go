@@ -0,0 +1,260 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"koth.cyber.cs.unh.edu/database"
+	"koth.cyber.cs.unh.edu/lib"
+)
+
+// A bcrypt hash to compare against when a team has no account, so a failed
+// login takes as long whether or not the team exists.
+const missingAccountHash = "$2a$10$twwgm47TJkv7XjhjDWikneX.LxbkBm1JAzK2f.5uZXydNG1Fvl/LG"
+
+// CreateTeamAccount gives team a new random portal password, replacing any
+// earlier one. Only its hash is stored, so the password is returned once
+// here and cannot be recovered later.
+func CreateTeamAccount(team string) (string, error) {
+	var password string = lib.RandomString(8)
+
+	if password == "" {
+		return "", fmt.Errorf("failed to generate password for %s", team)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.SetTeamPasswordHash(team, string(hash)); err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// AuthenticateTeam reports whether password is team's portal password.
+func AuthenticateTeam(team, password string) bool {
+	hash, err := database.GetTeamPasswordHash(team)
+
+	if err != nil {
+		bcrypt.CompareHashAndPassword([]byte(missingAccountHash), []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// ResetTeamPassword issues team a new portal password, also giving teams
+// created before accounts existed their first one.
+func (e *Environment) ResetTeamPassword(team, actor string) (string, error) {
+	if e.TeamByName(team) == nil {
+		return "", database.ErrTeamNotFound
+	}
+
+	password, err := CreateTeamAccount(team)
+
+	if err != nil {
+		return "", err
+	}
+
+	lib.Log.Status(fmt.Sprintf("[%s]: %s reset the portal password", team, actor))
+	return password, nil
+}
+
+// TeamSummaryJSON is a team's private view of its own box, with the latest
+// result of every check and why it failed. While the scoreboard is frozen,
+// the team sees its standing and results as of the freeze.
+func (e *Environment) TeamSummaryJSON(team string) ([]byte, error) {
+	ct := e.TeamByName(team)
+
+	if ct == nil {
+		return nil, database.ErrTeamNotFound
+	}
+
+	var services any
+	var score int = ct.Team.Score
+	var uptime float64 = 1.0
+	var until time.Time = time.Now()
+	var state freezeState = e.Freeze.snapshot()
+
+	if state.frozen() {
+		frozen, ok := state.team(team)
+
+		if !ok {
+			frozen = frozenTeam{Uptime: 1.0, Services: json.RawMessage("{}")}
+		}
+
+		score, uptime, services = frozen.Score, frozen.Uptime, frozen.Services
+		until = state.FrozenAt
+	} else {
+		var live map[string]any = make(map[string]any)
+
+		for check, sla := range ct.SLASnapshot() {
+			live[check] = map[string]any{
+				"uptime":     sla.Uptime(),
+				"streak":     sla.Streak,
+				"violations": sla.Violations,
+			}
+		}
+
+		if ct.Team.UptimeChecksTotal != 0 {
+			uptime = math.Round(float64(ct.Team.UptimeChecksPassed)/float64(ct.Team.UptimeChecksTotal)*100) / 100
+		}
+
+		services = live
+	}
+
+	var results []*database.DBCheckResult
+
+	rounds, err := database.GetRoundsInRange(time.Unix(0, 0), until, 2)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The newest round may have ended after the freeze
+	for _, round := range rounds {
+		if round.FinishedAt.After(until) || round.Void() {
+			continue
+		}
+
+		if results, err = database.GetCheckResults(round.ID, round.ID, team); err != nil {
+			return nil, err
+		}
+
+		break
+	}
+
+	var checks []map[string]any = make([]map[string]any, len(results))
+
+	for i, result := range results {
+		checks[i] = map[string]any{
+			"round":     result.RoundID,
+			"check":     result.Check,
+			"status":    result.Status,
+			"points":    result.Points,
+			"latencyMs": result.LatencyMS,
+			"reason":    result.Reason,
+			"evidence":  result.Evidence,
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"team":   ct.Team.Name,
+		"score":  score,
+		"uptime": uptime,
+		"frozen": state.frozen(),
+		"container": map[string]any{
+			"pve_id": ct.Team.ContainerID,
+			"ipv4":   ct.Team.ContainerIP,
+			"status": ct.Container.Status,
+		},
+		"checks":     checks,
+		"services":   services,
+		"lastUpdate": ct.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+// packetData is what the credentials packet template can use.
+type packetData struct {
+	Team     string
+	IP       string
+	Hostname string
+}
+
+// CredentialsPacketJSON is what a team needs to get into its box. The packet
+// text is rendered from lib.Config.Portal.PacketFile, read on every request
+// so it can be edited during the event; it is empty if there is no file.
+func (e *Environment) CredentialsPacketJSON(team string) ([]byte, error) {
+	ct := e.TeamByName(team)
+
+	if ct == nil {
+		return nil, database.ErrTeamNotFound
+	}
+
+	var data packetData = packetData{
+		Team:     ct.Team.Name,
+		IP:       ct.Team.ContainerIP,
+		Hostname: lib.ContainerHostname(ct.Team.Name),
+	}
+
+	var packet strings.Builder
+
+	if raw, err := os.ReadFile(lib.Config.Portal.PacketFile); err == nil {
+		tmpl, err := template.New("packet").Option("missingkey=error").Parse(string(raw))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse packet file: %w", err)
+		}
+
+		if err := tmpl.Execute(&packet, data); err != nil {
+			return nil, fmt.Errorf("failed to render packet file: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"team": ct.Team.Name,
+		"box": map[string]any{
+			"hostname": data.Hostname,
+			"ipv4":     ct.Team.ContainerIP,
+			"cidr":     lib.Config.Container.IndividualCIDR,
+			"gateway":  lib.Config.Container.GatewayIPv4,
+			"dns":      lib.Config.Container.Nameserver,
+			"search":   lib.Config.Container.SearchDomain,
+		},
+		"portal": map[string]any{
+			"username": ct.Team.Name,
+		},
+		"checks": json.RawMessage(ScoringJSON),
+		"packet": packet.String(),
+	})
+}
+
+// TeamInjectsJSON lists the released injects with team's own submission to
+// each, if any.
+func TeamInjectsJSON(team string) ([]byte, error) {
+	injects, err := database.GetInjects(time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	submissions, err := database.GetInjectSubmissions(0, team)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var byInject map[int64]*database.DBInjectSubmission = make(map[int64]*database.DBInjectSubmission, len(submissions))
+
+	for _, submission := range submissions {
+		byInject[submission.InjectID] = submission
+	}
+
+	var released []map[string]any = make([]map[string]any, len(injects))
+
+	for i, inject := range injects {
+		released[i] = map[string]any{
+			"id":         inject.ID,
+			"title":      inject.Title,
+			"body":       inject.Body,
+			"maxPoints":  inject.MaxPoints,
+			"releaseAt":  inject.ReleaseAt.Format(time.RFC3339),
+			"dueAt":      inject.DueAt.Format(time.RFC3339),
+			"submission": byInject[inject.ID],
+		}
+	}
+
+	return json.Marshal(released)
+}
@@ -1,6 +1,10 @@
 package lib
 
 import (
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/Netflix/go-env"
 	"github.com/joho/godotenv"
 )
@@ -42,6 +46,99 @@ type Environment struct {
 		SearchDomain   string `env:"CONTAINER_SEARCH_DOMAIN,required=true"`
 	}
 
+	Scoring struct {
+		ChecksFile    string        `env:"SCORING_CHECKS_FILE,default=checks.json"`
+		CheckTimeout  time.Duration `env:"SCORING_CHECK_TIMEOUT,default=10s"`
+		RoundInterval time.Duration `env:"SCORING_ROUND_INTERVAL,default=30s"`
+
+		// Spread each check's runs across this much of the round, 0 runs
+		// every check as soon as the round starts
+		Jitter time.Duration `env:"SCORING_JITTER,default=0s"`
+	}
+
+	// Canary checks against known-good targets, run before every round. A
+	// round where fewer than Required canaries pass is void.
+	Canary struct {
+		File     string `env:"CANARY_FILE,default=canaries.json"`
+		Required int    `env:"CANARY_REQUIRED,default=1"`
+	}
+
+	// Competition schedule, times are RFC3339. Breaks are comma separated
+	// start/end pairs, e.g. 2025-01-01T12:00:00Z/2025-01-01T13:00:00Z
+	Event struct {
+		Start  string `env:"EVENT_START"`
+		End    string `env:"EVENT_END"`
+		Breaks string `env:"EVENT_BREAKS"`
+
+		// Freeze the public scoreboard this long before the end, 0 disables it
+		FreezeBefore time.Duration `env:"EVENT_FREEZE_BEFORE,default=0"`
+	}
+
+	// Default SLA rule, checks can override it. Every Failures consecutive
+	// failed rounds of a check cost an extra Penalty points, 0 disables it.
+	SLA struct {
+		Failures int `env:"SLA_FAILURES,default=0"`
+		Penalty  int `env:"SLA_PENALTY,default=0"`
+	}
+
+	// King of the hill ownership claims
+	Ownership struct {
+		Enabled  bool   `env:"OWNERSHIP_ENABLED,default=false"`
+		Method   string `env:"OWNERSHIP_METHOD,default=http"`
+		HTTPPath string `env:"OWNERSHIP_HTTP_PATH,default=/team"`
+		File     string `env:"OWNERSHIP_FILE,default=/var/www/html/team"`
+		Points   int    `env:"OWNERSHIP_POINTS,default=5"`
+	}
+
+	// Team portal, PacketFile is a text/template rendered for each team as
+	// its credentials packet, with .Team, .IP and .Hostname
+	Portal struct {
+		PacketFile string `env:"TEAM_PACKET_FILE,default=packet.md"`
+	}
+
+	// Team requested reverts of a box to the snapshot called Snapshot, taken
+	// once the box is provisioned. Each costs Cost points and a team must
+	// wait Cooldown between them.
+	Revert struct {
+		Snapshot string        `env:"REVERT_SNAPSHOT,default=provisioned"`
+		Cost     int           `env:"REVERT_COST,default=50"`
+		Cooldown time.Duration `env:"REVERT_COOLDOWN,default=30m"`
+	}
+
+	// Red team flags, planted on every box as comma separated name=path
+	// pairs. A captured flag moves Points from the box's team to Name.
+	// Submissions authenticate with Token as a bearer token.
+	RedTeam struct {
+		Enabled bool   `env:"RED_TEAM_ENABLED,default=false"`
+		Name    string `env:"RED_TEAM_NAME,default=redteam"`
+		Token   string `env:"RED_TEAM_TOKEN"`
+		Flags   string `env:"RED_TEAM_FLAGS,default=root=/root/flag.txt"`
+		Points  int    `env:"RED_TEAM_POINTS,default=25"`
+	}
+
+	// Injects, teams submit their responses with a bearer token derived
+	// from TokenSecret. Without it only admins can submit.
+	Injects struct {
+		TokenSecret string `env:"INJECT_TOKEN_SECRET"`
+	}
+
+	// Remote scoring agents the head node accepts results from, as comma
+	// separated name=secret pairs. Results are merged with any, majority or
+	// all; Local also counts the head node's own result.
+	Agents struct {
+		List  string        `env:"AGENTS"`
+		Merge string        `env:"AGENTS_MERGE,default=any"`
+		Local bool          `env:"AGENTS_LOCAL,default=true"`
+		Grace time.Duration `env:"AGENTS_GRACE,default=2s"`
+	}
+
+	// Used when running as an agent with 'koth agent'
+	Agent struct {
+		Name    string `env:"AGENT_NAME"`
+		Secret  string `env:"AGENT_SECRET"`
+		HeadURL string `env:"AGENT_HEAD_URL"`
+	}
+
 	Database struct {
 		File      string `env:"DB_FILE,default=opnlaas.db"`
 		Salt      string `env:"DB_SALT,required=true"`
@@ -70,3 +167,23 @@ func InitEnv() error {
 
 	return nil
 }
+
+// InitAgentEnv loads only what an agent needs to run checks, so an agent host
+// does not need the head node's Proxmox or database settings.
+func InitAgentEnv() error {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, section := range []any{&Config.Agent, &Config.Scoring, &Config.SLA, &Config.SSH} {
+		if _, err := env.UnmarshalFromEnviron(section); err != nil {
+			return err
+		}
+	}
+
+	if Config.Agent.Name == "" || Config.Agent.Secret == "" || Config.Agent.HeadURL == "" {
+		return fmt.Errorf("AGENT_NAME, AGENT_SECRET and AGENT_HEAD_URL are required")
+	}
+
+	return nil
+}
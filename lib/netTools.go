@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -13,13 +14,17 @@ import (
 )
 
 func PingHost(ipAddress string) bool {
+	return PingHostContext(context.Background(), ipAddress)
+}
+
+func PingHostContext(ctx context.Context, ipAddress string) bool {
 	var cmd *exec.Cmd
 
 	switch runtime.GOOS {
 	case "windows":
-		cmd = exec.Command("ping", "-n", "1", "-w", "2000", ipAddress)
+		cmd = exec.CommandContext(ctx, "ping", "-n", "1", "-w", "2000", ipAddress)
 	default:
-		cmd = exec.Command("ping", "-c", "1", "-W", "2", ipAddress)
+		cmd = exec.CommandContext(ctx, "ping", "-c", "1", "-W", "2", ipAddress)
 	}
 
 	if err := cmd.Run(); err != nil {
@@ -44,7 +49,17 @@ func WaitOnline(ipAddress string) error {
 }
 
 func HttpGetHost(fullURL string) string {
-	resp, err := http.Get(fullURL)
+	return HttpGetHostContext(context.Background(), fullURL)
+}
+
+func HttpGetHostContext(ctx context.Context, fullURL string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+
+	if err != nil {
+		return ""
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
 		return ""
@@ -80,7 +80,7 @@ func (api *ProxmoxAPI) CreateContainer(node *proxmox.Node, ipAddress, teamName s
 		Value: Config.Container.StoragePool,
 	}, proxmox.ContainerOption{
 		Name:  "hostname",
-		Value: strings.ToLower(strings.ReplaceAll(fmt.Sprintf("%s-%s", Config.Container.HostnamePrefix, teamName), " ", "-")),
+		Value: ContainerHostname(teamName),
 	}, proxmox.ContainerOption{
 		Name:  "password",
 		Value: "password",
@@ -229,6 +229,67 @@ func (api *ProxmoxAPI) DeleteContainer(node *proxmox.Node, containerID int) erro
 	return nil
 }
 
+// SnapshotContainer takes a snapshot called name of the container.
+func (api *ProxmoxAPI) SnapshotContainer(node *proxmox.Node, containerID int, name string) error {
+	var err error
+	if node == nil {
+		node, err = api.NodeForContainer(containerID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	ct, err := node.Container(api.bg, containerID)
+
+	if err != nil {
+		return err
+	}
+
+	task, err := ct.NewSnapshot(api.bg, name)
+
+	if err != nil {
+		return err
+	}
+
+	if err := task.Wait(api.bg, time.Second, time.Minute*3); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RollbackContainer rolls the container back to the snapshot called name and
+// starts it again.
+func (api *ProxmoxAPI) RollbackContainer(node *proxmox.Node, containerID int, name string) error {
+	var err error
+	if node == nil {
+		node, err = api.NodeForContainer(containerID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	ct, err := node.Container(api.bg, containerID)
+
+	if err != nil {
+		return err
+	}
+
+	task, err := ct.RollbackSnapshot(api.bg, name, true)
+
+	if err != nil {
+		return err
+	}
+
+	if err := task.Wait(api.bg, time.Second, time.Minute*5); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (api *ProxmoxAPI) GetContainer(node *proxmox.Node, containerID int) (*proxmox.Container, error) {
 	var err error
 	if node == nil {
@@ -357,3 +418,8 @@ func (api *ProxmoxAPI) BulkDelete(ctIDs []int, bucketSize int) {
 		wg.Wait()
 	}
 }
+
+// ContainerHostname is the hostname of teamName's container.
+func ContainerHostname(teamName string) string {
+	return strings.ToLower(strings.ReplaceAll(fmt.Sprintf("%s-%s", Config.Container.HostnamePrefix, teamName), " ", "-"))
+}
@@ -1,10 +1,12 @@
 package lib
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"net"
 	"os"
 	"path/filepath"
 	"time"
@@ -82,9 +84,11 @@ func InitSSH() error {
 type SSHConnection struct {
 	client  *ssh.Client
 	session *ssh.Session
+	stop    func() bool
 }
 
 func (conn *SSHConnection) Close() {
+	conn.stop()
 	conn.session.Close()
 	conn.client.Close()
 }
@@ -108,6 +112,12 @@ func (conn *SSHConnection) SendWithOutput(command string) (int, string, error) {
 }
 
 func NewSSHConnection(ipAddress string) (*SSHConnection, error) {
+	return NewSSHConnectionContext(context.Background(), ipAddress)
+}
+
+// NewSSHConnectionContext dials the container as root. The connection is torn
+// down when ctx is done, which also aborts any command still running on it.
+func NewSSHConnectionContext(ctx context.Context, ipAddress string) (*SSHConnection, error) {
 	signer, err := ssh.ParsePrivateKey([]byte(SSHPrivateKey))
 	if err != nil {
 		return nil, err
@@ -121,13 +131,30 @@ func NewSSHConnection(ipAddress string) (*SSHConnection, error) {
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 
-	client, err := ssh.Dial("tcp", ipAddress+":22", config)
+	var address string = ipAddress + ":22"
+	var dialer net.Dialer
+
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		netConn.Close()
+	})
+
+	sshConn, channels, requests, err := ssh.NewClientConn(netConn, address, config)
 	if err != nil {
+		stop()
+		netConn.Close()
 		return nil, err
 	}
 
+	client := ssh.NewClient(sshConn, channels, requests)
+
 	session, err := client.NewSession()
 	if err != nil {
+		stop()
 		client.Close()
 		return nil, err
 	}
@@ -135,20 +162,29 @@ func NewSSHConnection(ipAddress string) (*SSHConnection, error) {
 	return &SSHConnection{
 		client:  client,
 		session: session,
+		stop:    stop,
 	}, nil
 }
 
 func NewSSHConnectionWithRetries(ipAddress string, maxRetries int) (*SSHConnection, error) {
+	return NewSSHConnectionWithRetriesContext(context.Background(), ipAddress, maxRetries)
+}
+
+func NewSSHConnectionWithRetriesContext(ctx context.Context, ipAddress string, maxRetries int) (*SSHConnection, error) {
 	var conn *SSHConnection
 	var err error
 
 	for range maxRetries {
-		conn, err = NewSSHConnection(ipAddress)
+		conn, err = NewSSHConnectionContext(ctx, ipAddress)
 		if err == nil {
 			return conn, nil
 		}
 
-		time.Sleep(time.Second + time.Duration(2)*time.Second)
+		select {
+		case <-time.After(time.Second + time.Duration(2)*time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
 	return nil, err
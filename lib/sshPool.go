@@ -0,0 +1,467 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type SSHPoolStats struct {
+	Open      int    `json:"open"`
+	Dials     uint64 `json:"dials"`
+	Reuses    uint64 `json:"reuses"`
+	Sessions  uint64 `json:"sessions"`
+	Evictions uint64 `json:"evictions"`
+	Failures  uint64 `json:"failures"`
+}
+
+// pooledSSHConn is one dialed connection. It is retired once it is a round
+// old and closed when the last session using it ends.
+type pooledSSHConn struct {
+	client   *ssh.Client
+	dialedAt time.Time
+	users    int
+	retired  bool
+}
+
+// sshDial is a dial in progress, shared by every acquire that finds no
+// connection while it runs.
+type sshDial struct {
+	done chan struct{}
+	conn *pooledSSHConn
+	err  error
+
+	// cancelled is set when the dial gave up on its own check's context
+	// rather than on the box
+	cancelled bool
+}
+
+// pooledSSHClient holds the connection to one IP. Its mutex is never held
+// while dialing, so an unreachable box only holds up the checks waiting for
+// the dial, and each of them can give up on its own context.
+type pooledSSHClient struct {
+	mutex sync.Mutex
+	conn  *pooledSSHConn
+	dial  *sshDial
+}
+
+// SSHPool keeps one authenticated root connection per container IP and opens
+// a new session on it for every command. Connections that error are evicted
+// and redialed on next use, and connections older than a round are redialed
+// so that a change to root's login is noticed within a round.
+type SSHPool struct {
+	mutex   sync.Mutex
+	clients map[string]*pooledSSHClient
+
+	dials, reuses, sessions, evictions, failures atomic.Uint64
+}
+
+var SSHClientPool *SSHPool = NewSSHPool()
+
+func NewSSHPool() *SSHPool {
+	return &SSHPool{
+		clients: make(map[string]*pooledSSHClient),
+	}
+}
+
+func dialSSHClient(ctx context.Context, ipAddress string) (*ssh.Client, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(SSHPrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User: "root",
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	var address string = ipAddress + ":22"
+	var dialer net.Dialer
+
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the handshake is bound to ctx, the connection outlives it
+	stop := context.AfterFunc(ctx, func() {
+		netConn.Close()
+	})
+
+	sshConn, channels, requests, err := ssh.NewClientConn(netConn, address, config)
+
+	if !stop() || err != nil {
+		netConn.Close()
+
+		if err == nil {
+			err = ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	return ssh.NewClient(sshConn, channels, requests), nil
+}
+
+// dialWithRetries dials ipAddress up to maxRetries times.
+func (pool *SSHPool) dialWithRetries(ctx context.Context, ipAddress string, maxRetries int) (*ssh.Client, error) {
+	var err error
+
+	for i := range max(maxRetries, 1) {
+		if i > 0 {
+			select {
+			case <-time.After(time.Second + time.Duration(2)*time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		pool.dials.Add(1)
+
+		var client *ssh.Client
+
+		if client, err = dialSSHClient(ctx, ipAddress); err == nil {
+			return client, nil
+		}
+	}
+
+	pool.failures.Add(1)
+
+	return nil, err
+}
+
+func (pool *SSHPool) entry(ipAddress string) *pooledSSHClient {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	entry, ok := pool.clients[ipAddress]
+
+	if !ok {
+		entry = &pooledSSHClient{}
+		pool.clients[ipAddress] = entry
+	}
+
+	return entry
+}
+
+// acquire returns the pooled connection to ipAddress, dialing a new one if
+// there is none or it is too old. Acquires that find a dial in progress wait
+// for it instead of dialing again. Every acquire must be paired with a
+// release.
+func (pool *SSHPool) acquire(ctx context.Context, ipAddress string, maxRetries int) (*pooledSSHConn, error) {
+	entry := pool.entry(ipAddress)
+
+	for {
+		entry.mutex.Lock()
+
+		if entry.conn != nil && time.Since(entry.conn.dialedAt) >= Config.Scoring.RoundInterval {
+			entry.conn.retire()
+			entry.conn = nil
+		}
+
+		if entry.conn != nil {
+			pool.reuses.Add(1)
+			entry.conn.users++
+			entry.mutex.Unlock()
+			return entry.conn, nil
+		}
+
+		if entry.dial == nil {
+			return pool.dial(ctx, entry, ipAddress, maxRetries)
+		}
+
+		var dial *sshDial = entry.dial
+		entry.mutex.Unlock()
+
+		select {
+		case <-dial.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if dial.cancelled {
+			continue
+		}
+
+		if dial.err != nil {
+			return nil, dial.err
+		}
+
+		entry.mutex.Lock()
+
+		if !dial.conn.retired {
+			pool.reuses.Add(1)
+			dial.conn.users++
+			entry.mutex.Unlock()
+			return dial.conn, nil
+		}
+
+		// Evicted before this acquire got to use it
+		entry.mutex.Unlock()
+	}
+}
+
+// dial opens entry's connection with the entry's mutex released, sharing the
+// result with the acquires that wait for it. The mutex must be held when it
+// is called and is released when it returns.
+func (pool *SSHPool) dial(ctx context.Context, entry *pooledSSHClient, ipAddress string, maxRetries int) (*pooledSSHConn, error) {
+	var dial *sshDial = &sshDial{done: make(chan struct{})}
+	entry.dial = dial
+	entry.mutex.Unlock()
+
+	client, err := pool.dialWithRetries(ctx, ipAddress, maxRetries)
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	entry.dial = nil
+	dial.err = err
+	dial.cancelled = err != nil && ctx.Err() != nil
+
+	if err == nil {
+		dial.conn = &pooledSSHConn{
+			client:   client,
+			dialedAt: time.Now(),
+			users:    1,
+		}
+
+		entry.conn = dial.conn
+	}
+
+	close(dial.done)
+
+	return dial.conn, err
+}
+
+// retire closes the connection once no session is using it. The entry's
+// mutex must be held.
+func (conn *pooledSSHConn) retire() {
+	conn.retired = true
+
+	if conn.users == 0 {
+		conn.client.Close()
+	}
+}
+
+func (pool *SSHPool) release(ipAddress string, conn *pooledSSHConn) {
+	entry := pool.entry(ipAddress)
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	conn.users--
+
+	if conn.retired && conn.users == 0 {
+		conn.client.Close()
+	}
+}
+
+// evict closes and forgets conn, ending the sessions still using it, since a
+// connection that errored cannot be trusted to serve them either.
+func (pool *SSHPool) evict(ipAddress string, conn *pooledSSHConn) {
+	entry := pool.entry(ipAddress)
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	conn.retired = true
+	conn.client.Close()
+
+	if entry.conn == conn {
+		entry.conn = nil
+		pool.evictions.Add(1)
+	}
+}
+
+func (pool *SSHPool) session(ctx context.Context, client *ssh.Client) (*ssh.Session, error) {
+	type sessionResult struct {
+		session *ssh.Session
+		err     error
+	}
+
+	var done chan sessionResult = make(chan sessionResult, 1)
+
+	go func() {
+		session, err := client.NewSession()
+		done <- sessionResult{session, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.session, result.err
+	case <-ctx.Done():
+		go func() {
+			if result := <-done; result.session != nil {
+				result.session.Close()
+			}
+		}()
+
+		return nil, ctx.Err()
+	}
+}
+
+// runSession runs command in session, returning the exit status and combined
+// output. broken reports that the connection itself failed.
+func runSession(ctx context.Context, session *ssh.Session, command string) (status int, output string, broken bool, err error) {
+	stop := context.AfterFunc(ctx, func() {
+		session.Close()
+	})
+
+	defer stop()
+
+	raw, err := session.CombinedOutput(command)
+
+	if err != nil {
+		var exitErr *ssh.ExitError
+
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitStatus(), string(raw), false, nil
+		}
+
+		if ctx.Err() != nil {
+			return -1, string(raw), false, ctx.Err()
+		}
+
+		return -1, string(raw), true, err
+	}
+
+	return 0, string(raw), false, nil
+}
+
+// Run executes command on the container at ipAddress over a pooled connection,
+// dialing up to maxRetries times if none is open. It returns the exit status
+// and combined output. Cancelling ctx aborts the command.
+func (pool *SSHPool) Run(ctx context.Context, ipAddress, command string, maxRetries int) (int, string, error) {
+	conn, err := pool.acquire(ctx, ipAddress, maxRetries)
+
+	if err != nil {
+		return -1, "", err
+	}
+
+	session, err := pool.session(ctx, conn.client)
+
+	if err != nil {
+		// The pooled connection went stale or is wedged, a session that
+		// cannot be opened in time is as bad as one that fails
+		pool.evict(ipAddress, conn)
+		pool.release(ipAddress, conn)
+
+		if ctx.Err() != nil {
+			pool.failures.Add(1)
+			return -1, "", err
+		}
+
+		if conn, err = pool.acquire(ctx, ipAddress, maxRetries); err != nil {
+			return -1, "", err
+		}
+
+		if session, err = pool.session(ctx, conn.client); err != nil {
+			pool.evict(ipAddress, conn)
+			pool.release(ipAddress, conn)
+			pool.failures.Add(1)
+			return -1, "", err
+		}
+	}
+
+	defer pool.release(ipAddress, conn)
+	defer session.Close()
+	pool.sessions.Add(1)
+
+	status, output, broken, err := runSession(ctx, session, command)
+
+	if broken {
+		pool.evict(ipAddress, conn)
+		pool.failures.Add(1)
+	}
+
+	return status, output, err
+}
+
+// RunFresh is Run over a connection of its own, dialed for this command and
+// closed after it. Checks that root can log in use it, so they are not
+// passed by a connection that authenticated before the login was changed.
+func (pool *SSHPool) RunFresh(ctx context.Context, ipAddress, command string, maxRetries int) (int, string, error) {
+	client, err := pool.dialWithRetries(ctx, ipAddress, maxRetries)
+
+	if err != nil {
+		return -1, "", err
+	}
+
+	defer client.Close()
+
+	session, err := pool.session(ctx, client)
+
+	if err != nil {
+		pool.failures.Add(1)
+		return -1, "", err
+	}
+
+	defer session.Close()
+	pool.sessions.Add(1)
+
+	status, output, broken, err := runSession(ctx, session, command)
+
+	if broken {
+		pool.failures.Add(1)
+	}
+
+	return status, output, err
+}
+
+func (pool *SSHPool) entries() []*pooledSSHClient {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	var entries []*pooledSSHClient = make([]*pooledSSHClient, 0, len(pool.clients))
+
+	for _, entry := range pool.clients {
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Stats reports the pool's counters. Connections that are being dialed are
+// not counted as open.
+func (pool *SSHPool) Stats() SSHPoolStats {
+	var stats SSHPoolStats = SSHPoolStats{
+		Dials:     pool.dials.Load(),
+		Reuses:    pool.reuses.Load(),
+		Sessions:  pool.sessions.Load(),
+		Evictions: pool.evictions.Load(),
+		Failures:  pool.failures.Load(),
+	}
+
+	for _, entry := range pool.entries() {
+		entry.mutex.Lock()
+
+		if entry.conn != nil {
+			stats.Open++
+		}
+
+		entry.mutex.Unlock()
+	}
+
+	return stats
+}
+
+func (pool *SSHPool) Close() {
+	for _, entry := range pool.entries() {
+		entry.mutex.Lock()
+
+		if entry.conn != nil {
+			entry.conn.client.Close()
+			entry.conn = nil
+		}
+
+		entry.mutex.Unlock()
+	}
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireWaitingForDialHonorsContext(t *testing.T) {
+	pool := NewSSHPool()
+	entry := pool.entry("192.0.2.1")
+
+	// Another check is still dialing the box
+	entry.dial = &sshDial{done: make(chan struct{})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var started time.Time = time.Now()
+
+	if _, err := pool.acquire(ctx, "192.0.2.1", 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the waiting acquire to give up with its context, got %v", err)
+	}
+
+	if waited := time.Since(started); waited > time.Second {
+		t.Fatalf("acquire waited %s for a dial it does not own", waited)
+	}
+
+	if !entry.mutex.TryLock() {
+		t.Fatal("the entry stayed locked while a dial was in progress")
+	}
+
+	entry.mutex.Unlock()
+}
+
+func TestAcquireSharesFailedDial(t *testing.T) {
+	pool := NewSSHPool()
+	entry := pool.entry("192.0.2.1")
+
+	var dial *sshDial = &sshDial{done: make(chan struct{})}
+	entry.dial = dial
+
+	var failed error = errors.New("connection refused")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+
+		entry.mutex.Lock()
+		entry.dial = nil
+		dial.err = failed
+		close(dial.done)
+		entry.mutex.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := pool.acquire(ctx, "192.0.2.1", 3); !errors.Is(err, failed) {
+		t.Fatalf("expected the dial's error, got %v", err)
+	}
+
+	if dials := pool.dials.Load(); dials != 0 {
+		t.Fatalf("expected the waiting acquire not to dial, it dialed %d times", dials)
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"koth.cyber.cs.unh.edu/database"
@@ -16,8 +21,11 @@ import (
 	"koth.cyber.cs.unh.edu/lib"
 )
 
+// Token is a login session. Team is empty for the admin, otherwise it is the
+// team the session belongs to.
 type Token struct {
 	Token   string
+	Team    string
 	Expires time.Time
 }
 
@@ -25,20 +33,29 @@ func (t *Token) Expired() bool {
 	return t.Expires.Before(time.Now())
 }
 
+// tokensLock guards tokens and the expiry of every token in it, requests
+// are served concurrently
+var tokensLock sync.Mutex
 var tokens []*Token = make([]*Token, 0)
 
-func NewToken() *Token {
+func NewToken(team string) *Token {
 	var token *Token = &Token{
 		Token:   lib.RandomString(48),
+		Team:    team,
 		Expires: time.Now().Add(time.Hour),
 	}
 
+	tokensLock.Lock()
 	tokens = append(tokens, token)
+	tokensLock.Unlock()
 
 	return token
 }
 
 func TokenFor(token string) *Token {
+	tokensLock.Lock()
+	defer tokensLock.Unlock()
+
 	for _, t := range tokens {
 		if t.Token == token {
 			return t
@@ -48,7 +65,25 @@ func TokenFor(token string) *Token {
 	return nil
 }
 
+// RenewToken returns the unexpired session for token, extending it.
+func RenewToken(token string) *Token {
+	tokensLock.Lock()
+	defer tokensLock.Unlock()
+
+	for _, t := range tokens {
+		if t.Token == token && !t.Expired() {
+			t.Expires = time.Now().Add(time.Hour)
+			return t
+		}
+	}
+
+	return nil
+}
+
 func DeleteToken(token string) {
+	tokensLock.Lock()
+	defer tokensLock.Unlock()
+
 	for i, t := range tokens {
 		if t.Token == token {
 			tokens = append(tokens[:i], tokens[i+1:]...)
@@ -58,6 +93,9 @@ func DeleteToken(token string) {
 }
 
 func CleanTokens() {
+	tokensLock.Lock()
+	defer tokensLock.Unlock()
+
 	var newTokens []*Token = make([]*Token, 0)
 	for _, t := range tokens {
 		if !t.Expired() {
@@ -75,36 +113,128 @@ func withCors(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
 }
 
-func withAuth(w http.ResponseWriter, r *http.Request) bool {
-
+// withSession returns the request's unexpired session, extending it.
+func withSession(w http.ResponseWriter, r *http.Request) *Token {
 	token, err := r.Cookie("token")
 
 	if err != nil || token == nil {
 		w.WriteHeader(http.StatusUnauthorized)
-		return false
+		return nil
 	}
 
-	if t := TokenFor(token.Value); t == nil {
+	t := RenewToken(token.Value)
+
+	if t == nil {
 		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	return t
+}
+
+func withAuth(w http.ResponseWriter, r *http.Request) bool {
+	t := withSession(w, r)
+
+	if t == nil {
 		return false
-	} else {
-		if t.Expired() {
-			w.WriteHeader(http.StatusUnauthorized)
-			return false
-		}
+	}
 
-		t.Expires = time.Now().Add(time.Hour)
+	if t.Team != "" {
+		w.WriteHeader(http.StatusForbidden)
+		return false
 	}
 
 	return true
 }
 
+// withTeamAuth returns the team a team session belongs to, and who is acting
+// for it. Admins can act for any team by naming it in the team query
+// parameter.
+func withTeamAuth(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	t := withSession(w, r)
+
+	if t == nil {
+		return "", "", false
+	}
+
+	if t.Team != "" {
+		return t.Team, t.Team, true
+	}
+
+	if team := r.URL.Query().Get("team"); team != "" {
+		return team, lib.Config.WebServer.Username, true
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	return "", "", false
+}
+
+// withAgentAuth checks that the request was signed by a configured agent and
+// returns the agent's name.
+func withAgentAuth(w http.ResponseWriter, r *http.Request, agents *environment.Agents, body []byte) (string, bool) {
+	var agent string = r.Header.Get("X-Koth-Agent")
+
+	if err := agents.Verify(agent, r.Header.Get("X-Koth-Timestamp"), r.Header.Get("X-Koth-Signature"), body); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+
+	return agent, true
+}
+
+// withRedTeamAuth accepts the red team's bearer token, or an admin login
+// submitting on its behalf, and returns who is submitting.
+func withRedTeamAuth(w http.ResponseWriter, r *http.Request, redTeam *environment.RedTeam) (string, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && redTeam.Authorize(token) {
+		return redTeam.Name, true
+	}
+
+	if !withAuth(w, r) {
+		return "", false
+	}
+
+	return lib.Config.WebServer.Username, true
+}
+
+// withInjectAuth accepts a team's inject token, or an admin login submitting
+// for the team named in the request, and returns the token's team, empty for
+// admins.
+func withInjectAuth(w http.ResponseWriter, r *http.Request, env *environment.Environment) (string, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if team := env.InjectTokenTeam(token); team != "" {
+			return team, true
+		}
+	}
+
+	if !withAuth(w, r) {
+		return "", false
+	}
+
+	return "", true
+}
+
+func writeInjectSubmitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, environment.ErrInvalidInject):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, database.ErrInjectNotFound), errors.Is(err, database.ErrTeamNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, database.ErrInjectClosed), errors.Is(err, database.ErrInjectSubmissionGraded):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	w.Write([]byte(err.Error()))
+}
+
 func serveInitScript(w http.ResponseWriter, r *http.Request) {
 	withCors(w, r)
 
@@ -130,6 +260,151 @@ func serveInitScript(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func parseTimeParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// serveJSON answers a plain GET with the output of build.
+func serveJSON(w http.ResponseWriter, r *http.Request, build func() ([]byte, error)) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	json, err := build()
+
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// serveHistory answers history queries through history, which decides how
+// much detail and how recent a history the caller may see.
+func serveHistory(w http.ResponseWriter, r *http.Request, history func(from, to time.Time, team string, limit int) ([]byte, error)) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	from, err := parseTimeParam(query.Get("from"), time.Unix(0, 0))
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(query.Get("to"), time.Now())
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var limit int
+
+	if query.Has("limit") {
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	json, err := history(from, to, query.Get("team"), limit)
+
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// serveEvents answers event queries through events, which decides how much of
+// the event log the caller may see.
+func serveEvents(w http.ResponseWriter, r *http.Request, events func(afterID int64, team, kind string, limit int) ([]byte, error)) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var after int64
+	var limit int
+	var err error
+
+	if query.Has("after") {
+		if after, err = strconv.ParseInt(query.Get("after"), 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if query.Has("limit") {
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	json, err := events(after, query.Get("team"), query.Get("kind"), limit)
+
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+func serveMatrix(w http.ResponseWriter, r *http.Request, matrix func(rounds int) ([]byte, error)) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var rounds int
+
+	if query := r.URL.Query(); query.Has("rounds") {
+		var err error
+
+		if rounds, err = strconv.Atoi(query.Get("rounds")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	json, err := matrix(rounds)
+
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
 func run() {
 	if err := lib.InitEnv(); err != nil {
 		lib.Log.Error(fmt.Sprintf("Error initializing environment: %s", err))
@@ -152,6 +427,20 @@ func run() {
 		lib.Log.Status("Database connected")
 	}
 
+	if err := environment.LoadScoringChecks(lib.Config.Scoring.ChecksFile); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading scoring checks: %s", err))
+		return
+	} else {
+		lib.Log.Status(fmt.Sprintf("Loaded %d scoring checks", len(environment.ScoringChecks)))
+	}
+
+	if err := environment.LoadCanaries(lib.Config.Canary.File); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading canaries: %s", err))
+		return
+	} else if len(environment.Canaries) > 0 {
+		lib.Log.Status(fmt.Sprintf("Loaded %d canaries", len(environment.Canaries)))
+	}
+
 	proxmox, err := lib.InitProxmox()
 
 	if err != nil {
@@ -168,6 +457,34 @@ func run() {
 		lib.Log.Status("Environment pulled from database")
 	}
 
+	if env.Schedule, err = environment.LoadSchedule(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading event schedule: %s", err))
+		return
+	}
+
+	if env.Agents, err = environment.LoadAgents(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading agents: %s", err))
+		return
+	}
+
+	if err := env.CheckRoundBudget(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error scheduling scoring checks: %s", err))
+		return
+	}
+
+	if env.RedTeam, err = environment.LoadRedTeam(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading red team: %s", err))
+		return
+	} else if env.RedTeam.Enabled() && env.TeamByName(env.RedTeam.Name) != nil {
+		lib.Log.Error(fmt.Sprintf("Red team name %s is already used by a team", env.RedTeam.Name))
+		return
+	}
+
+	if err := env.FailInterruptedReverts(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error refunding interrupted reverts: %s", err))
+		return
+	}
+
 	env.Print()
 
 	envUpdateChannel := env.InitAutoUpdate()
@@ -224,14 +541,20 @@ func run() {
 			return
 		}
 
+		var team string
+
 		if obj.Username != lib.Config.WebServer.Username || obj.Password != lib.Config.WebServer.Password {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
+			if !environment.AuthenticateTeam(obj.Username, obj.Password) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			team = obj.Username
 		}
 
 		http.SetCookie(w, &http.Cookie{
 			Name:     "token",
-			Value:    NewToken().Token,
+			Value:    NewToken(team).Token,
 			Path:     "/",
 			SameSite: http.SameSiteNoneMode,
 			Secure:   lib.Config.WebServer.TlsDir != "",
@@ -243,7 +566,7 @@ func run() {
 	http.HandleFunc("/api/logout", func(w http.ResponseWriter, r *http.Request) {
 		withCors(w, r)
 
-		if !withAuth(w, r) {
+		if withSession(w, r) == nil {
 			return
 		}
 
@@ -262,28 +585,1179 @@ func run() {
 		if t := TokenFor(token.Value); t == nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
-		} else {
-			DeleteToken(token.Value)
+		} else {
+			DeleteToken(token.Value)
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "token",
+			Value:    "",
+			Path:     "/",
+			SameSite: http.SameSiteNoneMode,
+			Secure:   lib.Config.WebServer.TlsDir != "",
+		})
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/api/create", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			Name string `json:"name"`
+			IP   string `json:"ip"`
+		}{}
+
+		err := json.Unmarshal(body, &obj)
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if lib.PingHost(obj.IP) {
+			w.WriteHeader(http.StatusIMUsed)
+			return
+		}
+
+		_, password, err := env.CreateContainer(obj.Name, obj.IP, true)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Only the hash is kept, so this is the one chance to hand it out
+		response, err := json.Marshal(map[string]string{
+			"team":     obj.Name,
+			"username": obj.Name,
+			"password": password,
+		})
+
+		if err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	})
+
+	http.HandleFunc("/api/sshpool.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		json, err := json.Marshal(lib.SSHClientPool.Stats())
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(json)
+	})
+
+	http.HandleFunc("/api/pause", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := env.Schedule.Pause(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		lib.Log.Status("Event paused")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/api/resume", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := env.Schedule.Resume(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		lib.Log.Status("Event resumed")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/api/freeze", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := env.FreezeScoreboard(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/api/reveal", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := env.RevealScoreboard(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/api/multipliers", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		var rules []environment.MultiplierRule
+
+		if err := json.Unmarshal(body, &rules); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := env.Multipliers.Set(rules); err != nil {
+			if errors.Is(err, environment.ErrInvalidMultiplier) {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		lib.Log.Status(fmt.Sprintf("Multipliers updated, %d rules", len(rules)))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/api/ledger.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+
+		var limit int
+
+		if query.Has("limit") {
+			var err error
+
+			if limit, err = strconv.Atoi(query.Get("limit")); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		json, err := environment.LedgerJSON(query.Get("team"), query.Get("source"), limit)
+
+		if err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(json)
+	})
+
+	http.HandleFunc("/api/ledger/add", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			Team   string `json:"team"`
+			Amount int    `json:"amount"`
+			Source string `json:"source"`
+			Reason string `json:"reason"`
+		}{
+			Source: database.LedgerSourceManual,
+		}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		entry := &database.DBLedgerEntry{
+			Team:   obj.Team,
+			Source: obj.Source,
+			Amount: obj.Amount,
+			Reason: obj.Reason,
+			Actor:  lib.Config.WebServer.Username,
+		}
+
+		if err := env.AdjustScore(entry); err != nil {
+			switch {
+			case errors.Is(err, environment.ErrInvalidAdjustment):
+				w.WriteHeader(http.StatusBadRequest)
+			case errors.Is(err, database.ErrTeamNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(entry.JSON())
+	})
+
+	http.HandleFunc("/api/ledger/revert", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			ID     int64  `json:"id"`
+			Reason string `json:"reason"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil || obj.Reason == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		revert, err := env.RevertAdjustment(obj.ID, lib.Config.WebServer.Username, obj.Reason)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrLedgerEntryNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, database.ErrLedgerEntryReverted), errors.Is(err, database.ErrLedgerRevertOfRevert):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(revert.JSON())
+	})
+
+	http.HandleFunc("/api/rounds/void", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			ID     int64  `json:"id"`
+			Reason string `json:"reason"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		reverts, err := env.VoidRound(obj.ID, lib.Config.WebServer.Username, obj.Reason)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, environment.ErrInvalidAdjustment):
+				w.WriteHeader(http.StatusBadRequest)
+			case errors.Is(err, database.ErrRoundNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, database.ErrRoundAlreadyVoid), errors.Is(err, database.ErrRoundRunning):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if reverts == nil {
+			reverts = []*database.DBLedgerEntry{}
+		}
+
+		response, err := json.Marshal(reverts)
+
+		if err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	})
+
+	http.HandleFunc("/api/rescore", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			Apply  bool   `json:"apply"`
+			Reason string `json:"reason"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		report, err := env.Rescore(obj.Apply, lib.Config.WebServer.Username, obj.Reason)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, environment.ErrInvalidAdjustment):
+				w.WriteHeader(http.StatusBadRequest)
+			case errors.Is(err, environment.ErrChecksChanged):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		response, err := json.Marshal(report)
+
+		if err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	})
+
+	http.HandleFunc("/api/public/summary.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+		serveJSON(w, r, env.PublicJSON)
+	})
+
+	http.HandleFunc("/api/summary.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		serveJSON(w, r, env.JSON)
+	})
+
+	http.HandleFunc("/api/public/scoring.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(environment.ScoringJSON)
+	})
+
+	http.HandleFunc("/api/public/schedule.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+		serveJSON(w, r, env.ScheduleJSON)
+	})
+
+	http.HandleFunc("/api/public/multipliers.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+		serveJSON(w, r, env.MultipliersJSON)
+	})
+
+	http.HandleFunc("/api/public/history.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+		serveHistory(w, r, env.PublicHistoryJSON)
+	})
+
+	http.HandleFunc("/api/history.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		serveHistory(w, r, func(from, to time.Time, team string, limit int) ([]byte, error) {
+			return environment.HistoryJSON(from, to, team, limit, true)
+		})
+	})
+
+	http.HandleFunc("/api/public/events.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+		serveEvents(w, r, env.PublicEventsJSON)
+	})
+
+	http.HandleFunc("/api/events.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		serveEvents(w, r, func(afterID int64, team, kind string, limit int) ([]byte, error) {
+			return environment.EventsJSON(afterID, 0, team, kind, limit)
+		})
+	})
+
+	http.HandleFunc("/api/public/matrix.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+		serveMatrix(w, r, env.PublicMatrixJSON)
+	})
+
+	http.HandleFunc("/api/matrix.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		serveMatrix(w, r, env.MatrixJSON)
+	})
+
+	http.HandleFunc("/api/injects/create", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			Title     string    `json:"title"`
+			Body      string    `json:"body"`
+			MaxPoints int       `json:"maxPoints"`
+			ReleaseAt time.Time `json:"releaseAt"`
+			DueAt     time.Time `json:"dueAt"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		inject := &database.DBInject{
+			Title:     obj.Title,
+			Body:      obj.Body,
+			MaxPoints: obj.MaxPoints,
+			ReleaseAt: obj.ReleaseAt,
+			DueAt:     obj.DueAt,
+			CreatedBy: lib.Config.WebServer.Username,
+		}
+
+		if err := environment.CreateInject(inject); err != nil {
+			if errors.Is(err, environment.ErrInvalidInject) {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(inject.JSON())
+	})
+
+	http.HandleFunc("/api/public/injects.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+		serveJSON(w, r, func() ([]byte, error) {
+			return environment.InjectsJSON(false)
+		})
+	})
+
+	http.HandleFunc("/api/injects.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return environment.InjectsJSON(true)
+		})
+	})
+
+	http.HandleFunc("/api/injects/submit", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, ok := withInjectAuth(w, r, env)
+
+		if !ok {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		// Responses can be large, so read all of it; escaping may grow the
+		// response up to six times in JSON
+		body, err := io.ReadAll(io.LimitReader(r.Body, 6*environment.MaxInjectResponse+1024))
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		obj := struct {
+			Inject   int64  `json:"inject"`
+			Team     string `json:"team"`
+			Response string `json:"response"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// A team's token only submits for that team
+		if team != "" {
+			if obj.Team != "" && obj.Team != team {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			obj.Team = team
+		}
+
+		submission, err := env.SubmitInject(obj.Inject, obj.Team, obj.Response)
+
+		if err != nil {
+			writeInjectSubmitError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(submission.JSON())
+	})
+
+	http.HandleFunc("/api/injects/tokens.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if lib.Config.Injects.TokenSecret == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		serveJSON(w, r, env.InjectTokensJSON)
+	})
+
+	http.HandleFunc("/api/injects/submissions.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		query := r.URL.Query()
+
+		var id int64
+
+		if query.Has("inject") {
+			var err error
+
+			if id, err = strconv.ParseInt(query.Get("inject"), 10, 64); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return environment.InjectSubmissionsJSON(id, query.Get("team"))
+		})
+	})
+
+	http.HandleFunc("/api/injects/grade", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			Submission int64  `json:"submission"`
+			Points     int    `json:"points"`
+			Comment    string `json:"comment"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		submission, err := env.GradeInject(obj.Submission, obj.Points, obj.Comment, lib.Config.WebServer.Username)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrInvalidGrade):
+				w.WriteHeader(http.StatusBadRequest)
+			case errors.Is(err, database.ErrInjectSubmissionNotFound), errors.Is(err, database.ErrInjectNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(submission.JSON())
+	})
+
+	http.HandleFunc("/api/teams/password", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			Team string `json:"team"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		password, err := env.ResetTeamPassword(obj.Team, lib.Config.WebServer.Username)
+
+		if err != nil {
+			if errors.Is(err, database.ErrTeamNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		response, err := json.Marshal(map[string]string{
+			"team":     obj.Team,
+			"username": obj.Team,
+			"password": password,
+		})
+
+		if err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	})
+
+	http.HandleFunc("/api/team/summary.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, _, ok := withTeamAuth(w, r)
+
+		if !ok {
+			return
+		}
+
+		if env.TeamByName(team) == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return env.TeamSummaryJSON(team)
+		})
+	})
+
+	http.HandleFunc("/api/team/credentials.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, _, ok := withTeamAuth(w, r)
+
+		if !ok {
+			return
+		}
+
+		if env.TeamByName(team) == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return env.CredentialsPacketJSON(team)
+		})
+	})
+
+	http.HandleFunc("/api/team/history.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, _, ok := withTeamAuth(w, r)
+
+		if !ok {
+			return
+		}
+
+		serveHistory(w, r, func(from, to time.Time, _ string, limit int) ([]byte, error) {
+			return env.TeamHistoryJSON(from, to, team, limit)
+		})
+	})
+
+	http.HandleFunc("/api/team/injects.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, _, ok := withTeamAuth(w, r)
+
+		if !ok {
+			return
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return environment.TeamInjectsJSON(team)
+		})
+	})
+
+	http.HandleFunc("/api/team/injects/submit", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, _, ok := withTeamAuth(w, r)
+
+		if !ok {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 6*environment.MaxInjectResponse+1024))
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		obj := struct {
+			Inject   int64  `json:"inject"`
+			Response string `json:"response"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		submission, err := env.SubmitInject(obj.Inject, team, obj.Response)
+
+		if err != nil {
+			writeInjectSubmitError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(submission.JSON())
+	})
+
+	http.HandleFunc("/api/team/revert", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, actor, ok := withTeamAuth(w, r)
+
+		if !ok {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		revert, err := env.RequestRevert(team, actor)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrTeamNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, database.ErrBoxRevertInProgress), errors.Is(err, database.ErrBoxRevertCooldown):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(revert.JSON())
+	})
+
+	http.HandleFunc("/api/team/reverts.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		team, _, ok := withTeamAuth(w, r)
+
+		if !ok {
+			return
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return environment.BoxRevertsJSON(team)
+		})
+	})
+
+	http.HandleFunc("/api/reverts.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return environment.BoxRevertsJSON(r.URL.Query().Get("team"))
+		})
+	})
+
+	http.HandleFunc("/api/redteam/submit", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !env.RedTeam.Enabled() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		actor, ok := withRedTeamAuth(w, r, env.RedTeam)
+
+		if !ok {
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+
+		obj := struct {
+			Flag string `json:"flag"`
+		}{}
+
+		if err := json.Unmarshal(body, &obj); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		flag, err := env.CaptureFlag(obj.Flag, actor)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrFlagNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, database.ErrFlagCaptured):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				fmt.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		response, err := json.Marshal(map[string]any{
+			"team":   flag.Team,
+			"flag":   flag.Name,
+			"points": flag.Points,
+		})
+
+		if err != nil {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	})
+
+	http.HandleFunc("/api/public/redteam.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !env.RedTeam.Enabled() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		serveJSON(w, r, env.PublicRedTeamJSON)
+	})
+
+	http.HandleFunc("/api/redteam.json", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if !env.RedTeam.Enabled() {
+			w.WriteHeader(http.StatusNotFound)
+			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    "",
-			Path:     "/",
-			SameSite: http.SameSiteNoneMode,
-			Secure:   lib.Config.WebServer.TlsDir != "",
+		serveJSON(w, r, func() ([]byte, error) {
+			return env.RedTeamJSON(time.Time{})
 		})
-
-		w.WriteHeader(http.StatusOK)
 	})
 
-	http.HandleFunc("/api/create", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/flags.json", func(w http.ResponseWriter, r *http.Request) {
 		withCors(w, r)
 
 		if !withAuth(w, r) {
 			return
 		}
 
+		serveJSON(w, r, func() ([]byte, error) {
+			return environment.FlagsJSON(r.URL.Query().Get("team"))
+		})
+	})
+
+	http.HandleFunc("/api/agent/assignments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, ok := withAgentAuth(w, r, env.Agents, nil); !ok {
+			return
+		}
+
+		serveJSON(w, r, func() ([]byte, error) {
+			return json.Marshal(env.Agents.Assignments())
+		})
+	})
+
+	http.HandleFunc("/api/agent/results", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
@@ -294,65 +1768,39 @@ func run() {
 			return
 		}
 
-		body := make([]byte, r.ContentLength)
-		r.Body.Read(body)
-
-		obj := struct {
-			Name string `json:"name"`
-			IP   string `json:"ip"`
-		}{}
-
-		err := json.Unmarshal(body, &obj)
+		// The signature covers the exact body, so read all of it
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		if lib.PingHost(obj.IP) {
-			w.WriteHeader(http.StatusIMUsed)
-			return
-		}
+		agent, ok := withAgentAuth(w, r, env.Agents, body)
 
-		if _, err := env.CreateContainer(obj.Name, obj.IP, true); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+		if !ok {
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-	})
-
-	http.HandleFunc("/api/public/summary.json", func(w http.ResponseWriter, r *http.Request) {
-		withCors(w, r)
+		var report environment.AgentReport
 
-		if r.Method != "GET" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+		if err := json.Unmarshal(body, &report); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		json, err := env.JSON()
+		if err := env.Agents.Report(agent, report); err != nil {
+			if errors.Is(err, environment.ErrAgentStaleRound) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
 
-		if err != nil {
 			fmt.Println(err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(json)
-	})
-
-	http.HandleFunc("/api/public/scoring.json", func(w http.ResponseWriter, r *http.Request) {
-		withCors(w, r)
-
-		if r.Method != "GET" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(environment.ScoringJSON)
+		w.WriteHeader(http.StatusOK)
 	})
 
 	go func() {
@@ -373,6 +1821,7 @@ func run() {
 
 	// Cleanup
 	envUpdateChannel <- true
+	lib.SSHClientPool.Close()
 }
 
 func initTeams() {
@@ -413,6 +1862,11 @@ func initTeams() {
 		lib.Log.Status("Environment pulled from database")
 	}
 
+	if env.RedTeam, err = environment.LoadRedTeam(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading red team: %s", err))
+		return
+	}
+
 	env.Print()
 
 	reader := bufio.NewReader(os.Stdin)
@@ -569,13 +2023,24 @@ func initTeams() {
 		}
 	}()
 
-	env.EfficientBulkCreate(inputs, 5)
+	passwords := env.EfficientBulkCreate(inputs, 5)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 	webServer.Shutdown(ctx)
 
 	env.Print()
+
+	// Shown to the operator once and never logged, only the hashes are kept
+	if len(passwords) > 0 {
+		fmt.Println("Portal logins (team / password):")
+
+		for _, input := range inputs {
+			if password, ok := passwords[input[0]]; ok {
+				fmt.Printf("\t%s / %s\n", input[0], password)
+			}
+		}
+	}
 }
 
 func purge() {
@@ -642,6 +2107,319 @@ func purge() {
 	lib.Log.Success("Purge complete")
 }
 
+// syncTeamScore stores a team's ledger total in the teams table. A running
+// server picks the change up at the end of its next round.
+func syncTeamScore(team string) error {
+	totals, err := database.GetLedgerTotals()
+
+	if err != nil {
+		return err
+	}
+
+	return database.UpdateTeamScore(team, totals[team])
+}
+
+func ledger(args []string) {
+	if len(args) == 0 || args[0] == "help" {
+		fmt.Println("Usage: ./koth ledger <command>")
+		fmt.Println("\tlist [team] - Show the latest ledger entries")
+		fmt.Println("\tadd <team> <amount> <manual|inject> <reason> - Adjust a team's score")
+		fmt.Println("\trevert <id> <reason> - Cancel a ledger entry")
+		return
+	}
+
+	if err := lib.InitEnv(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error initializing environment: %s", err))
+		return
+	}
+
+	if err := database.Connect(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error connecting to database: %s", err))
+		return
+	}
+
+	var actor string = "cli"
+
+	if user := os.Getenv("USER"); user != "" {
+		actor += ":" + user
+	}
+
+	switch args[0] {
+	case "list":
+		var team string
+
+		if len(args) > 1 {
+			team = args[1]
+		}
+
+		entries, err := database.GetLedgerEntries(team, "", 50)
+
+		if err != nil {
+			lib.Log.Error(fmt.Sprintf("Error reading ledger: %s", err))
+			return
+		}
+
+		for _, entry := range entries {
+			var note string
+
+			if entry.Reverts != 0 {
+				note = fmt.Sprintf(" (reverts #%d)", entry.Reverts)
+			} else if entry.RevertedBy != 0 {
+				note = fmt.Sprintf(" (reverted by #%d)", entry.RevertedBy)
+			}
+
+			fmt.Printf("#%d\t%s\t%s\t%+d\t%s\t%s: %s%s\n", entry.ID, entry.CreatedAt.Format(time.RFC3339), entry.Team, entry.Amount, entry.Source, entry.Actor, entry.Reason, note)
+		}
+	case "add":
+		if len(args) < 5 {
+			lib.Log.Error("Usage: ./koth ledger add <team> <amount> <manual|inject> <reason>")
+			return
+		}
+
+		amount, err := strconv.Atoi(args[2])
+
+		if err != nil {
+			lib.Log.Error(fmt.Sprintf("Invalid amount %q", args[2]))
+			return
+		}
+
+		entry := &database.DBLedgerEntry{
+			Team:   args[1],
+			Amount: amount,
+			Source: args[3],
+			Reason: strings.Join(args[4:], " "),
+			Actor:  actor,
+		}
+
+		if err := environment.ValidateAdjustment(entry); err != nil {
+			lib.Log.Error(err.Error())
+			return
+		}
+
+		if !database.TeamExists(entry.Team) {
+			lib.Log.Error(fmt.Sprintf("Team %s does not exist", entry.Team))
+			return
+		}
+
+		if err := database.CreateLedgerEntries([]*database.DBLedgerEntry{entry}); err != nil {
+			lib.Log.Error(fmt.Sprintf("Error adding ledger entry: %s", err))
+			return
+		}
+
+		if err := syncTeamScore(entry.Team); err != nil {
+			lib.Log.Error(fmt.Sprintf("Error updating team score: %s", err))
+			return
+		}
+
+		lib.Log.Success(fmt.Sprintf("Added ledger entry #%d: %+d for %s", entry.ID, entry.Amount, entry.Team))
+	case "revert":
+		if len(args) < 3 {
+			lib.Log.Error("Usage: ./koth ledger revert <id> <reason>")
+			return
+		}
+
+		id, err := strconv.ParseInt(args[1], 10, 64)
+
+		if err != nil {
+			lib.Log.Error(fmt.Sprintf("Invalid ledger entry id %q", args[1]))
+			return
+		}
+
+		revert, err := database.RevertLedgerEntry(id, actor, strings.Join(args[2:], " "))
+
+		if err != nil {
+			lib.Log.Error(fmt.Sprintf("Error reverting ledger entry: %s", err))
+			return
+		}
+
+		if err := syncTeamScore(revert.Team); err != nil {
+			lib.Log.Error(fmt.Sprintf("Error updating team score: %s", err))
+			return
+		}
+
+		lib.Log.Success(fmt.Sprintf("Reverted ledger entry #%d with #%d: %+d for %s", id, revert.ID, revert.Amount, revert.Team))
+	default:
+		lib.Log.Error(fmt.Sprintf("Unknown ledger command %q, see './koth ledger help'", args[0]))
+	}
+}
+
+func rescore(args []string) {
+	if len(args) > 0 && args[0] == "help" {
+		fmt.Println("Usage: ./koth rescore [apply <reason>]")
+		fmt.Println("\tWithout apply, shows how scoring history with the current checks file would change the scores")
+		return
+	}
+
+	var apply bool = len(args) > 0 && args[0] == "apply"
+
+	if len(args) > 0 && !apply {
+		lib.Log.Error(fmt.Sprintf("Unknown rescore command %q, see './koth rescore help'", args[0]))
+		return
+	}
+
+	if err := lib.InitEnv(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error initializing environment: %s", err))
+		return
+	}
+
+	if err := database.Connect(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error connecting to database: %s", err))
+		return
+	}
+
+	if err := environment.LoadScoringChecks(lib.Config.Scoring.ChecksFile); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading scoring checks: %s", err))
+		return
+	}
+
+	var actor string = "cli"
+
+	if user := os.Getenv("USER"); user != "" {
+		actor += ":" + user
+	}
+
+	var reason string
+
+	if apply {
+		reason = strings.Join(args[1:], " ")
+	}
+
+	report, err := environment.RescoreHistory(apply, actor, reason)
+
+	if err != nil {
+		lib.Log.Error(fmt.Sprintf("Error rescoring: %s", err))
+		return
+	}
+
+	for _, change := range report.Changes {
+		fmt.Printf("%s\t%s\t%d results\t%d -> %d\t%+d\n", change.Team, change.Check, change.Results, change.Before, change.After, change.After-change.Before)
+	}
+
+	var teams []string
+
+	for _, entry := range report.Entries {
+		if !slices.Contains(teams, entry.Team) {
+			teams = append(teams, entry.Team)
+		}
+
+		if !apply {
+			fmt.Printf("%s\tround %d\t%+d\n", entry.Team, entry.RoundID, entry.Amount)
+			continue
+		}
+
+		fmt.Printf("%s\tround %d\t%+d\t#%d\n", entry.Team, entry.RoundID, entry.Amount, entry.ID)
+	}
+
+	if apply {
+		for _, team := range teams {
+			if err := syncTeamScore(team); err != nil {
+				lib.Log.Error(fmt.Sprintf("Error updating team score: %s", err))
+				return
+			}
+		}
+	}
+
+	switch {
+	case len(report.Changes) == 0:
+		lib.Log.Success("Scores already match the current checks")
+	case apply:
+		lib.Log.Success(fmt.Sprintf("Rescored %d checks of %d teams", len(report.Changes), len(teams)))
+	default:
+		lib.Log.Status(fmt.Sprintf("%d checks would change, use './koth rescore apply <reason>' to apply", len(report.Changes)))
+	}
+}
+
+func migrate(args []string) {
+	if len(args) == 0 || args[0] == "help" {
+		fmt.Println("Usage: ./koth migrate <command>")
+		fmt.Println("\tstatus - Show which schema migrations the database has applied")
+		fmt.Println("\tup - Apply pending migrations, as run does on startup")
+		return
+	}
+
+	if args[0] != "status" && args[0] != "up" {
+		lib.Log.Error(fmt.Sprintf("Unknown migrate command %q, see './koth migrate help'", args[0]))
+		return
+	}
+
+	if err := lib.InitEnv(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error initializing environment: %s", err))
+		return
+	}
+
+	if err := database.Open(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error opening database: %s", err))
+		return
+	}
+
+	if args[0] == "up" {
+		applied, err := database.Migrate()
+
+		for _, migration := range applied {
+			lib.Log.Success(fmt.Sprintf("Applied migration %d (%s)", migration.Version, migration.Name))
+		}
+
+		if err != nil {
+			lib.Log.Error(fmt.Sprintf("Error migrating database: %s", err))
+			return
+		}
+
+		if len(applied) == 0 {
+			lib.Log.Status("Database schema is already up to date")
+		}
+
+		return
+	}
+
+	migrations, err := database.Migrations()
+
+	if err != nil {
+		lib.Log.Error(fmt.Sprintf("Error reading migrations: %s", err))
+		return
+	}
+
+	var pending int
+
+	for _, migration := range migrations {
+		if !migration.Applied() {
+			pending++
+			fmt.Printf("%04d\t%s\tpending\n", migration.Version, migration.Name)
+			continue
+		}
+
+		fmt.Printf("%04d\t%s\tapplied %s\n", migration.Version, migration.Name, migration.AppliedAt.Format(time.RFC3339))
+	}
+
+	if pending == 0 {
+		lib.Log.Success(fmt.Sprintf("Database schema is up to date with %d migrations", len(migrations)))
+	} else {
+		lib.Log.Status(fmt.Sprintf("%d of %d migrations pending, they are applied when the server starts or by './koth migrate up'", pending, len(migrations)))
+	}
+}
+
+func agent() {
+	if err := lib.InitAgentEnv(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error initializing agent: %s", err))
+		return
+	}
+
+	if err := lib.InitSSH(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error initializing SSH: %s", err))
+		return
+	}
+
+	if err := environment.LoadScoringChecks(lib.Config.Scoring.ChecksFile); err != nil {
+		lib.Log.Error(fmt.Sprintf("Error loading scoring checks: %s", err))
+		return
+	}
+
+	lib.Log.Status(fmt.Sprintf("Agent %s running %d scoring checks for %s", lib.Config.Agent.Name, len(environment.ScoringChecks), lib.Config.Agent.HeadURL))
+
+	if err := environment.RunAgent(); err != nil {
+		lib.Log.Error(fmt.Sprintf("Agent stopped: %s", err))
+	}
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: ./koth <mode>\n\tuse 'modes' to see available modes")
@@ -655,10 +2433,22 @@ func main() {
 		initTeams()
 	case "purge":
 		purge()
+	case "ledger":
+		ledger(os.Args[2:])
+	case "rescore":
+		rescore(os.Args[2:])
+	case "migrate":
+		migrate(os.Args[2:])
+	case "agent":
+		agent()
 	default:
 		fmt.Println("Available modes:")
 		fmt.Println("\trun - Run the King of the Hill environment normally")
 		fmt.Println("\tinit - Manually create teams through the CLI")
+		fmt.Println("\tledger - List, add or revert score adjustments, see 'ledger help'")
+		fmt.Println("\trescore - Preview or apply scoring history again with the current check weights")
+		fmt.Println("\tmigrate - Show or apply database schema migrations, see 'migrate help'")
+		fmt.Println("\tagent - Run scoring checks for a head node from this host, see AGENT_* settings")
 		fmt.Println("\tpurge - Destroy any and all king of the hill instances in Proxmox, wipe the database, remove keys.\n\t\tWill only remove proxmox containers with the name starting with env.CONTAINER_HOSTNAME_PREFIX")
 	}
 }